@@ -12,11 +12,12 @@ import (
 
 // BatchBookInfo 包含批量处理时的书籍信息和资源路径
 type BatchBookInfo struct {
-	Book         *model.Book
-	CoverPath    string
-	HeaderPath   string
-	HeaderFolder string
-	Config       *config.Config // 该书籍使用的配置
+	Book            *model.Book
+	CoverPath       string
+	CoverBackground string // 文件夹通用封面，配置了封面模板时作为模板背景
+	HeaderPath      string
+	HeaderFolder    string
+	Config          *config.Config // 该书籍使用的配置
 }
 
 // scanBooks 扫描文件夹获取所有书籍
@@ -190,10 +191,11 @@ func scanSubFolder(subFolder, outputFolder string, parentGlobalResources map[str
 		}
 
 		info := BatchBookInfo{
-			Book:         book,
-			CoverPath:    localResources["cover"],
-			HeaderPath:   localResources["header"],
-			HeaderFolder: headerFolder,
+			Book:            book,
+			CoverPath:       localResources["cover"],
+			CoverBackground: localResources["cover"],
+			HeaderPath:      localResources["header"],
+			HeaderFolder:    headerFolder,
 		}
 
 		// 优先使用子文件夹配置，其次继承父文件夹配置
@@ -258,6 +260,10 @@ func findResourcesForBook(info BatchBookInfo, folder, bookName string, globalRes
 	if info.CoverPath == "" {
 		info.CoverPath = globalResources["cover"]
 	}
+	// 使用的是文件夹通用封面时，可作为封面模板的背景
+	if info.CoverPath != "" && info.CoverPath == globalResources["cover"] {
+		info.CoverBackground = info.CoverPath
+	}
 	if info.HeaderPath == "" {
 		info.HeaderPath = globalResources["header"]
 	}
@@ -327,6 +333,7 @@ func applyBookResources(book *model.Book, info BatchBookInfo) {
 	if info.CoverPath != "" {
 		book.Cover = info.CoverPath
 	}
+	book.CoverBackground = info.CoverBackground
 	if info.HeaderPath != "" {
 		book.ChapterHeaderImage = info.HeaderPath
 	}
@@ -32,14 +32,17 @@ func NewBookArgs(cliCfg *CLIConfig) *model.Book {
 	var book model.Book
 	flag.StringVar(&book.Filename, "filename", "", "txt 文件名")
 	flag.StringVar(&book.Bookname, "bookname", "", "书名: 默认为txt文件名")
-	flag.StringVar(&book.Author, "author", "YSTYLE", "作者")
+	flag.StringVar(&book.Author, "author", "YSTYLE", "作者, 多人用顿号、&或逗号分隔, 也可以写成: 东野圭吾 著、李盈春 译")
 	flag.StringVar(&book.Match, "match", "", "匹配标题的正则表达式, 不写可以自动识别, 如果没生成章节就参考教程。例: -match 第.{1,8}章 表示第和章字之间可以有1-8个任意文字")
 	flag.StringVar(&book.VolumeMatch, "volume-match", model.VolumeMatch, "卷匹配规则,设置为false可以禁用卷识别")
 	flag.StringVar(&book.ExclusionPattern, "exclude", model.DefaultExclusion, "排除无效章节/卷的正则表达式")
 	flag.StringVar(&book.UnknowTitle, "unknow-title", "章节正文", "未知章节默认名称")
-	flag.StringVar(&book.Cover, "cover", "cover.png", "封面图片可为: 本地图片, 和orly。 设置为orly时生成orly风格的封面, 需要连接网络。")
-	flag.StringVar(&book.CoverOrlyColor, "cover-orly-color", "", "orly封面的主题色, 可以为1-16和hex格式的颜色代码, 不填时随机")
-	flag.IntVar(&book.CoverOrlyIdx, "cover-orly-idx", -1, "orly封面的动物, 可以为0-41, 不填时随机, 具体图案可以查看: https://orly.nanmu.me")
+	flag.StringVar(&book.Cover, "cover", "cover.png", "封面图片可为: 本地图片, gen, template 和 orly。 设置为gen时在本地生成封面, 设置为template时按配置文件中的封面模板(cover_template)生成, 设置为orly时生成orly风格的封面(需要连接网络, 失败时改为本地生成)。")
+	flag.StringVar(&book.CoverOrlyColor, "cover-orly-color", "", "gen/orly封面的主题色, 可以为1-16和hex格式的颜色代码, 不填时随机")
+	flag.IntVar(&book.CoverOrlyIdx, "cover-orly-idx", -1, "orly封面的动物, 可以为0-41, 不填时随机, 具体图案可以查看: https://orly.nanmu.me; gen封面时为背景图案(取除以6的余数)")
+	flag.StringVar(&book.CoverSize, "cover-size", "1600x2560", "封面尺寸, 封面会缩放为该尺寸的JPG图片")
+	flag.StringVar(&book.CoverFit, "cover-fit", "letterbox", "封面比例与目标尺寸不一致时的处理方式: letterbox(补边), crop(居中裁剪), none(保持原图不处理)")
+	flag.IntVar(&book.CoverQuality, "cover-quality", 90, "封面JPG质量: 1-100")
 	flag.UintVar(&book.Max, "max", 35, "标题最大字数")
 	flag.UintVar(&book.Indent, "indent", 2, "段落缩进字数")
 	flag.StringVar(&book.Align, "align", utils.GetEnv("KAF_CLI_ALIGN", "center"), "标题对齐方式: left、center、righ。环境变量KAF_CLI_ALIGN可修改默认值")
@@ -50,6 +53,9 @@ func NewBookArgs(cliCfg *CLIConfig) *model.Book {
 	flag.StringVar(&book.Format, "format", utils.GetEnv("KAF_CLI_FORMAT", "all"), "书籍格式: all、epub、mobi、azw3。环境变量KAF_CLI_FORMAT可修改默认值")
 	flag.StringVar(&book.Out, "out", "", "输出文件名，不需要包含格式后缀")
 	flag.BoolVar(&book.Tips, "tips", true, "添加本软件教程")
+	flag.StringVar(&book.TipsFile, "tips-file", "", "自定义制作说明文件(.txt 或 .html), 存在 文件名.语言.扩展名 时按语言使用, 如 tips.ja.txt")
+	flag.StringVar(&book.TipsTitle, "tips-title", "", "制作说明标题, 默认按语言显示")
+	flag.StringVar(&book.TipsPosition, "tips-position", "both", "制作说明位置: start(正文前), end(正文后), both(前后都添加)")
 	flag.BoolVar(&book.SeparateChapterNumber, "separate-chapter-number", false, "是否分离章节序号和标题样式（序号单独一行显示）")
 	flag.StringVar(&book.CustomCSSFile, "custom-css-file", "", "自定义 CSS 文件路径，用于覆盖默认样式")
 
@@ -65,6 +71,72 @@ func NewBookArgs(cliCfg *CLIConfig) *model.Book {
 	flag.StringVar(&book.ChapterHeaderImageWidth, "chapter-header-image-width", "100%", "页眉图片宽度，如: 50%, 200px")
 	flag.StringVar(&book.ChapterHeaderImageMode, "chapter-header-image-mode", "single", "图片模式: single(所有章节相同), folder(按章节名匹配)")
 
+	// 元数据
+	flag.StringVar(&book.BookID, "book-id", "", "书籍唯一标识, 如 urn:uuid:xxx, 为空时根据书名、作者、语言和系列生成, 重复转换时保持不变")
+	flag.StringVar(&book.Translator, "translator", "", "译者, 多人用顿号、&或逗号分隔")
+	flag.StringVar(&book.Editor, "editor", "", "编者, 多人用顿号、&或逗号分隔")
+	flag.StringVar(&book.Illustrator, "illustrator", "", "插画作者, 多人用顿号、&或逗号分隔")
+	flag.StringVar(&book.Series, "series", "", "系列名")
+	flag.StringVar(&book.SeriesIndex, "series-index", "", "在系列中的序号, 如 2 或 2.5")
+	flag.StringVar(&book.Description, "description", "", "内容简介")
+	flag.StringVar(&book.Publisher, "publisher", "", "出版社")
+	flag.StringVar(&book.PubDate, "pub-date", "", "出版日期, 格式: 2006-01-02、2006-01 或 2006")
+	flag.StringVar(&book.Tags, "tags", "", "标签, 多个用逗号分隔")
+	flag.StringVar(&book.ISBN, "isbn", "", "ISBN")
+	flag.StringVar(&book.Identifiers, "identifiers", "", "其他标识符, 格式 scheme:value, 多个用逗号分隔, 如 douban:1007305")
+
+	// Calibre
+	flag.BoolVar(&book.CalibreMetadata, "calibre-metadata", false, "在输出文件旁生成 Calibre 的 OPF 元数据和封面")
+	flag.StringVar(&book.OutputLayout, "output-layout", "flat", "输出目录结构: flat(直接输出), calibre(按 作者/书名/ 输出)")
+
+	// 目录
+	flag.BoolVar(&book.TocPage, "toc-page", false, "在正文前添加目录页")
+
+	// 页面模板
+	flag.StringVar(&book.ChapterTemplate, "chapter-template", "", "章节页面模板文件(Go html/template)")
+	flag.StringVar(&book.VolumeTemplate, "volume-template", "", "卷页面模板文件(Go html/template)")
+	flag.StringVar(&book.TitlePageTemplate, "title-page-template", "", "书名页模板文件(Go html/template), 设置后在正文前添加书名页")
+	flag.StringVar(&book.ColophonPageTemplate, "colophon-page-template", "", "版权页模板文件(Go html/template), 设置后添加版权页")
+	flag.StringVar(&book.AboutPageTemplate, "about-page-template", "", "内容简介页模板文件(Go html/template), 设置后添加内容简介页")
+	flag.StringVar(&book.TocPageTemplate, "toc-page-template", "", "目录页模板文件(Go html/template), 开启目录页时使用")
+
+	// 正文前的页面
+	flag.BoolVar(&book.TitlePage, "title-page", false, "在正文前添加书名页(书名、作者、系列)")
+	flag.BoolVar(&book.ColophonPage, "colophon-page", false, "在正文前添加版权页(来源、转换日期、软件版本)")
+	flag.BoolVar(&book.AboutPage, "about-page", false, "在正文前添加内容简介页, 没有内容简介时不添加")
+	flag.StringVar(&book.Source, "source", "", "来源, 显示在版权页中, 如网址或底本")
+
+	// 校验
+	flag.BoolVar(&book.Validate, "validate", false, "生成 EPUB 后检查是否符合规范, 也可以单独运行 kaf-cli validate book.epub")
+
+	// 分册
+	flag.IntVar(&book.SplitChapters, "split-chapters", 0, "每册最多章节数, 超出时拆分为多册, 优先在卷之间拆分, 0 表示不拆分")
+	flag.IntVar(&book.SplitChars, "split-chars", 0, "每册最多字数, 0 表示不限制")
+	flag.IntVar(&book.SplitTextSize, "split-text-size", 0, "每册正文最大 MB 数, 按未压缩的正文估算, 不含图片和字体, 不是输出文件的大小, 0 表示不限制")
+
+	// 书籍信息识别
+	flag.Func("filename-pattern", "从文件名提取书籍信息的正则, 命名分组: title, author, series, series_index, 可重复设置, 按顺序匹配", func(pattern string) error {
+		book.FilenamePatterns = append(book.FilenamePatterns, pattern)
+		return nil
+	})
+
+	// 输入格式
+	flag.StringVar(&book.InputFormat, "input-format", "auto", "输入格式: auto(自动识别), txt(普通文本), aozora(青空文库注记格式, 支持Shift_JIS编码)")
+
+	// 脚注
+	flag.StringVar(&book.FootnoteMatch, "footnote-match", model.DefaultFootnoteMatch, "脚注标记正则, 第一个非空分组为脚注编号, 设置为false可以禁用脚注识别")
+
+	// 版式
+	flag.StringVar(&book.WritingMode, "writing-mode", "horizontal", "排版方向: horizontal(横排), vertical(竖排, 适用于日文和繁体中文)")
+	flag.StringVar(&book.FirstParagraph, "first-paragraph", "none", "章节首段样式: none(不处理), dropcap(首字下沉), firstline(首行加粗), both(首字下沉和首行加粗)")
+
+	// 注音
+	flag.StringVar(&book.Ruby, "ruby", "ruby", "注音标记(｜漢字《かんじ》)处理方式: ruby(生成注音), strip(去除注音), false(不处理)")
+
+	// 编码错误报告
+	flag.BoolVar(&book.DecodeReport, "decode-report", false, "输出无法解码字符所在的章节和行号，便于修正源文件")
+	flag.IntVar(&book.MaxDecodeErrors, "max-decode-errors", 0, "无法解码字符数上限，超过时转换失败，0 表示不限制")
+
 	// YAML 配置文件支持
 	flag.StringVar(&cliCfg.ConfigPath, "config", "", "YAML 配置文件路径，自动识别时可不指定")
 
@@ -77,6 +149,7 @@ func printHelp(version string) {
 	fmt.Println("软件版本: 	", version)
 	fmt.Println("简洁模式: 	把文件拖放到kaf-cli上")
 	fmt.Println("命令行简单模式: kaf-cli ebook.txt")
+	fmt.Println("校验EPUB: 	kaf-cli validate book.epub")
 	fmt.Println("\n以下为kaf-cli的全部参数")
 	var cliCfg CLIConfig
 	NewBookArgs(&cliCfg)
@@ -102,6 +175,11 @@ func main() {
 		return
 	}
 
+	// 校验 EPUB: kaf-cli validate book.epub
+	if len(os.Args) >= 2 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Args[2:]))
+	}
+
 	// 检查是否是批量处理模式
 	if len(os.Args) == 3 && os.Args[1] == "-batch" {
 		batchFolder := os.Args[2]
@@ -153,17 +231,14 @@ func main() {
 	}
 
 	if err := core.Check(book, version); err != nil {
-		if err.Error() == "不是txt文件" {
-			fmt.Printf("错误: %s\n", err.Error())
-			os.Exit(1)
-		}
-		fmt.Println(err)
-		printHelp(version)
+		// 参数已经解析过, 不能再调用 printHelp 重新注册参数
+		fmt.Printf("错误: %s\n", err.Error())
 		os.Exit(1)
 	}
 	analytics.Analytics(version, secret, measurement, book.Format)
 	book.ToString()
 	if err := core.Parse(book); err != nil {
+		book.Cleanup()
 		fmt.Printf("错误: %s\n", err.Error())
 		os.Exit(2)
 	}
@@ -232,6 +307,7 @@ func convertBook(book *model.Book, version string) error {
 	}
 
 	if err := core.Parse(book); err != nil {
+		book.Cleanup()
 		return fmt.Errorf("parsing failed: %w", err)
 	}
 
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/feewg/kaf-cli/internal/validator"
+)
+
+// runValidate 校验 EPUB 文件, 有错误时返回非 0 退出码
+func runValidate(files []string) int {
+	if len(files) == 0 {
+		fmt.Println("用法: kaf-cli validate book.epub [more.epub ...]")
+		return 2
+	}
+	code := 0
+	for _, filename := range files {
+		issues, err := validator.Validate(filename)
+		if err != nil {
+			fmt.Printf("错误: %s\n", err.Error())
+			code = 1
+			continue
+		}
+		validator.Print(filename, issues)
+		if validator.HasError(issues) {
+			code = 1
+		}
+	}
+	return code
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/feewg/kaf-cli/internal/model"
+	"github.com/feewg/kaf-cli/internal/utils"
 	"gopkg.in/yaml.v3"
 )
 
@@ -26,6 +27,12 @@ type Config struct {
 	Cover          string `yaml:"cover"`            // 封面图片
 	CoverOrlyColor string `yaml:"cover_orly_color"` // orly封面主题色
 	CoverOrlyIdx   int    `yaml:"cover_orly_idx"`   // orly封面动物索引
+	CoverSize      string `yaml:"cover_size"`       // 封面尺寸, 如 1600x2560
+	CoverFit       string `yaml:"cover_fit"`        // 封面比例处理: letterbox, crop, none
+	CoverQuality   int    `yaml:"cover_quality"`    // 封面JPG质量
+
+	// 封面模板
+	CoverTemplate *utils.CoverTemplate `yaml:"cover_template"` // 封面模板, cover 为 template 时使用
 
 	// 排版配置
 	Max        uint   `yaml:"max"`         // 标题最大字数
@@ -41,8 +48,11 @@ type Config struct {
 	Out    string `yaml:"out"`    // 输出文件名
 
 	// 其他选项
-	Tips                  bool `yaml:"tips"`                     // 添加教程
-	SeparateChapterNumber bool `yaml:"separate_chapter_number"`  // 分离章节序号和标题样式
+	Tips                  bool   `yaml:"tips"`                     // 添加教程
+	TipsFile              string `yaml:"tips_file"`                // 自定义制作说明文件
+	TipsTitle             string `yaml:"tips_title"`               // 制作说明标题
+	TipsPosition          string `yaml:"tips_position"`            // 制作说明位置: start, end, both
+	SeparateChapterNumber bool   `yaml:"separate_chapter_number"`  // 分离章节序号和标题样式
 
 	// 自定义CSS
 	CustomCSSFile string `yaml:"custom_css_file"` // 自定义CSS文件路径
@@ -56,6 +66,69 @@ type Config struct {
 	ChapterHeaderImageHeight   string `yaml:"chapter_header_image_height"`   // 页眉图片高度
 	ChapterHeaderImageWidth    string `yaml:"chapter_header_image_width"`    // 页眉图片宽度
 	ChapterHeaderImageMode     string `yaml:"chapter_header_image_mode"`     // 图片模式
+
+	// 元数据
+	BookID      string `yaml:"book_id"`      // 书籍唯一标识, 为空时自动生成
+	Translator  string `yaml:"translator"`   // 译者
+	Editor      string `yaml:"editor"`       // 编者
+	Illustrator string `yaml:"illustrator"`  // 插画作者
+	Series      string `yaml:"series"`       // 系列名
+	SeriesIndex string `yaml:"series_index"` // 系列序号
+	Description string `yaml:"description"`  // 内容简介
+	Publisher   string `yaml:"publisher"`    // 出版社
+	PubDate     string `yaml:"pub_date"`     // 出版日期
+	Tags        string `yaml:"tags"`         // 标签, 逗号分隔
+	ISBN        string `yaml:"isbn"`         // ISBN
+	Identifiers string `yaml:"identifiers"`  // 其他标识符, scheme:value
+
+	// Calibre
+	CalibreMetadata bool   `yaml:"calibre_metadata"` // 生成 Calibre 的 OPF 元数据和封面
+	OutputLayout    string `yaml:"output_layout"`    // 输出目录结构: flat, calibre
+
+	// 目录
+	TocPage bool `yaml:"toc_page"` // 在正文前添加目录页
+
+	// 校验
+	Validate bool `yaml:"validate"` // 生成 EPUB 后检查是否符合规范
+
+	// 页面模板
+	ChapterTemplate   string `yaml:"chapter_template"`    // 章节页面模板
+	VolumeTemplate    string `yaml:"volume_template"`     // 卷页面模板
+	TitlePageTemplate    string `yaml:"title_page_template"`    // 书名页模板
+	ColophonPageTemplate string `yaml:"colophon_page_template"` // 版权页模板
+	AboutPageTemplate    string `yaml:"about_page_template"`    // 内容简介页模板
+	TocPageTemplate      string `yaml:"toc_page_template"`      // 目录页模板
+
+	// 正文前的页面
+	TitlePage    bool   `yaml:"title_page"`    // 书名页
+	ColophonPage bool   `yaml:"colophon_page"` // 版权页
+	AboutPage    bool   `yaml:"about_page"`    // 内容简介页
+	Source       string `yaml:"source"`        // 来源, 显示在版权页中
+
+	// 分册
+	SplitChapters int `yaml:"split_chapters"`  // 每册最多章节数
+	SplitChars    int `yaml:"split_chars"`     // 每册最多字数
+	SplitTextSize int `yaml:"split_text_size"` // 每册正文最大 MB 数
+
+	// 书籍信息识别
+	FilenamePatterns []string `yaml:"filename_patterns"` // 文件名规则, 命名分组: title, author, series, series_index
+
+	// 输入格式
+	InputFormat string `yaml:"input_format"` // 输入格式: auto, txt, aozora
+
+	// 脚注
+	FootnoteMatch string `yaml:"footnote_match"` // 脚注标记正则，设置为false禁用
+
+	// 版式
+	WritingMode    string `yaml:"writing_mode"`    // 排版方向: horizontal, vertical
+	FirstParagraph string `yaml:"first_paragraph"` // 章节首段样式: none, dropcap, firstline, both
+
+	// 注音
+	Ruby string `yaml:"ruby"` // 注音处理方式: ruby, strip, false
+
+	// 编码错误报告
+	DecodeReport    bool `yaml:"decode_report"`     // 输出编码错误详细报告
+	MaxDecodeErrors int  `yaml:"max_decode_errors"` // 无法解码字符数上限，0 表示不限制
 }
 
 // DefaultConfigNames 默认配置文件名（按优先级排序）
@@ -201,6 +274,21 @@ func (c *Config) MergeWithBook(book *model.Book) {
 	if c.UnknowTitle != "" && book.UnknowTitle == "章节正文" {
 		book.UnknowTitle = c.UnknowTitle
 	}
+	if c.CoverTemplate != nil && book.CoverTemplate == nil {
+		book.CoverTemplate = c.CoverTemplate
+	}
+	if c.OutputLayout != "" && book.OutputLayout == "flat" {
+		book.OutputLayout = c.OutputLayout
+	}
+	if c.TipsPosition != "" && book.TipsPosition == "both" {
+		book.TipsPosition = c.TipsPosition
+	}
+	if c.FirstParagraph != "" && book.FirstParagraph == "none" {
+		book.FirstParagraph = c.FirstParagraph
+	}
+	if len(c.FilenamePatterns) > 0 && len(book.FilenamePatterns) == 0 {
+		book.FilenamePatterns = c.FilenamePatterns
+	}
 }
 
 // mergeStringField 合并字符串字段（只覆盖默认值）
@@ -252,6 +340,10 @@ func (c *Config) ToBook(filename string) *model.Book {
 		Cover:                      c.Cover,
 		CoverOrlyColor:             c.CoverOrlyColor,
 		CoverOrlyIdx:               c.CoverOrlyIdx,
+		CoverSize:                  c.CoverSize,
+		CoverFit:                   c.CoverFit,
+		CoverQuality:               c.CoverQuality,
+		CoverTemplate:              c.CoverTemplate,
 		Max:                        c.Max,
 		Indent:                     c.Indent,
 		Align:                      c.Align,
@@ -262,6 +354,9 @@ func (c *Config) ToBook(filename string) *model.Book {
 		Format:                     c.Format,
 		Out:                        c.Out,
 		Tips:                       c.Tips,
+		TipsFile:                   c.TipsFile,
+		TipsTitle:                  c.TipsTitle,
+		TipsPosition:               c.TipsPosition,
 		SeparateChapterNumber:      c.SeparateChapterNumber,
 		CustomCSSFile:              c.CustomCSSFile,
 		ExtendedCSS:                c.ExtendedCSS,
@@ -272,6 +367,43 @@ func (c *Config) ToBook(filename string) *model.Book {
 		ChapterHeaderImageHeight:   c.ChapterHeaderImageHeight,
 		ChapterHeaderImageWidth:    c.ChapterHeaderImageWidth,
 		ChapterHeaderImageMode:     c.ChapterHeaderImageMode,
+		BookID:                     c.BookID,
+		Translator:                 c.Translator,
+		Editor:                     c.Editor,
+		Illustrator:                c.Illustrator,
+		Series:                     c.Series,
+		SeriesIndex:                c.SeriesIndex,
+		Description:                c.Description,
+		Publisher:                  c.Publisher,
+		PubDate:                    c.PubDate,
+		Tags:                       c.Tags,
+		ISBN:                       c.ISBN,
+		Identifiers:                c.Identifiers,
+		CalibreMetadata:            c.CalibreMetadata,
+		OutputLayout:               c.OutputLayout,
+		TocPage:                    c.TocPage,
+		Validate:                   c.Validate,
+		ChapterTemplate:            c.ChapterTemplate,
+		VolumeTemplate:             c.VolumeTemplate,
+		TitlePageTemplate:          c.TitlePageTemplate,
+		ColophonPageTemplate:       c.ColophonPageTemplate,
+		AboutPageTemplate:          c.AboutPageTemplate,
+		TocPageTemplate:            c.TocPageTemplate,
+		TitlePage:                  c.TitlePage,
+		ColophonPage:               c.ColophonPage,
+		AboutPage:                  c.AboutPage,
+		Source:                     c.Source,
+		SplitChapters:              c.SplitChapters,
+		SplitChars:                 c.SplitChars,
+		SplitTextSize:              c.SplitTextSize,
+		FilenamePatterns:           c.FilenamePatterns,
+		InputFormat:                c.InputFormat,
+		FootnoteMatch:              c.FootnoteMatch,
+		WritingMode:                c.WritingMode,
+		FirstParagraph:             c.FirstParagraph,
+		Ruby:                       c.Ruby,
+		DecodeReport:               c.DecodeReport,
+		MaxDecodeErrors:            c.MaxDecodeErrors,
 	}
 
 	model.SetDefault(book)
@@ -293,9 +425,33 @@ exclude: "^第[0-9一二三四五六七八九十零〇百千两 ]+(部门|部队
 unknow_title: "章节正文"
 
 # 封面配置
+# 封面: 本地图片路径, gen(本地生成), orly(在线生成), none(无封面)
 cover: "cover.png"
 cover_orly_color: ""
 cover_orly_idx: -1
+# 封面预处理: 缩放为指定尺寸的JPG, 比例不一致时 letterbox 补边, crop 裁剪, none 不处理
+cover_size: "1600x2560"
+cover_fit: "letterbox"
+cover_quality: 90
+# 封面模板: cover 设置为 template 时使用, 批量转换时文件夹中的 cover.jpg 会作为模板背景
+# 坐标基于 cover_size, 未设置的项使用默认值
+# cover_template:
+#   background: "background.jpg"
+#   background_color: "#333333"
+#   font: ""
+#   title:
+#     x: 160
+#     y: 1024
+#     width: 1280
+#     size: 144
+#     color: "#ffffff"
+#     align: "left"
+#     max_lines: 3
+#   author:
+#     y: 1920
+#     size: 84
+#     color: "#dddddd"
+#     align: "right"
 
 # 排版配置
 max: 35
@@ -312,6 +468,11 @@ out: ""
 
 # 其他选项
 tips: true
+# 制作说明: 默认按语言显示 kaf-cli 的说明和教程链接
+# tips_file 为 .txt(每行一段) 或 .html(页面片段), 存在 tips.ja.txt 这样带语言的文件时按 lang 使用
+tips_file: ""
+tips_title: ""
+tips_position: "both"   # start 正文前, end 正文后, both 前后都添加
 separate_chapter_number: false
 
 # 自定义CSS
@@ -326,5 +487,79 @@ chapter_header_image_position: "center"
 chapter_header_image_height: "auto"
 chapter_header_image_width: "100%"
 chapter_header_image_mode: "single"
+
+# 元数据
+# 作者、译者等多人时用顿号、&或逗号分隔, 作者中也可以写成 "东野圭吾 著、李盈春 译"
+book_id: ""           # 书籍唯一标识, 为空时根据书名、作者、语言和系列生成, 重复转换时保持不变
+translator: ""
+editor: ""
+illustrator: ""
+series: ""
+series_index: ""
+description: ""
+publisher: ""
+pub_date: ""          # 2006-01-02、2006-01 或 2006
+tags: ""              # 多个用逗号分隔, 如 "玄幻,修真"
+isbn: ""
+identifiers: ""       # 格式 scheme:value, 如 "douban:1007305"
+
+# Calibre: 在输出文件旁生成 OPF 元数据和封面, 便于 calibredb add 导入系列、标签和标识符
+# output_layout 为 calibre 时按 作者/书名/ 的目录结构输出
+calibre_metadata: false
+output_layout: "flat"
+
+# 目录页: 在正文前添加带链接的目录页, 阅读器自带的目录不受影响
+toc_page: false
+
+# 校验: 生成 EPUB 后检查 mimetype、container.xml、manifest/spine、XHTML 格式和链接, 也可以单独运行 kaf-cli validate book.epub
+validate: false
+
+# 页面模板: Go html/template 文件, 生成页面 <body> 中的内容, 为空时使用内置的页面
+# 可用的数据见 docs/features.md 的"页面模板"一节
+chapter_template: ""
+volume_template: ""
+title_page_template: ""      # 设置后在正文前添加书名页
+colophon_page_template: ""   # 设置后添加版权页
+about_page_template: ""      # 设置后添加内容简介页
+toc_page_template: ""        # 开启 toc_page 时使用
+
+# 正文前的页面, 依次为 书名页、版权页、内容简介页, 可用 div.titlepage、div.colophon、div.about 等自定义样式
+title_page: false     # 书名、作者和系列
+colophon_page: false  # 书名、作者、出版社、ISBN、来源、转换日期和软件版本
+about_page: false     # 内容简介, 没有简介时不添加
+source: ""            # 来源, 如网址或底本
+
+# 分册: 超出任一上限时拆分为多册, 优先在卷之间拆分, 0 表示不限制
+# 每册书名为 "书名 (卷一)", 没有设置 series 时以书名作为系列名关联各册
+split_chapters: 0
+split_chars: 0
+split_text_size: 0    # MB, 按未压缩的正文估算, 不含图片和字体, 不是输出文件的大小
+
+# 文件名规则: 从文件名(不含扩展名)提取书籍信息, 按顺序匹配, 最后使用默认规则 《书名》...作者：作者名
+# 命名分组: title 书名, author 作者, series 系列, series_index 系列序号
+# 文件开头的 书名：、作者：、内容简介：、标签： 等书籍信息会自动识别, 不会出现在正文中
+# filename_patterns:
+#   - "^(?P<title>.+?)\\s*by\\s*(?P<author>.+)$"
+#   - "^\\[(?P<series>[^\\]]+)\\s*(?P<series_index>\\d+)\\](?P<title>.+)$"
+
+# 输入格式: auto 自动识别, txt 普通文本, aozora 青空文库注记格式
+input_format: "auto"
+
+# 脚注（第一个非空分组为脚注编号，设置为 false 禁用）
+footnote_match: ""
+
+# 排版方向: horizontal 横排, vertical 竖排（从右向左翻页）
+writing_mode: "horizontal"
+
+# 章节首段样式: none 不处理, dropcap 首字下沉, firstline 首行加粗, both 首字下沉和首行加粗
+# 首段标记为 p.first, 首字为 span.first-letter, 可用自定义 CSS 修改样式
+first_paragraph: "none"
+
+# 注音（｜漢字《かんじ》）: ruby 生成注音, strip 去除注音, false 不处理
+ruby: "ruby"
+
+# 编码错误报告
+decode_report: false
+max_decode_errors: 0
 `
 }
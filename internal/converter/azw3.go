@@ -2,120 +2,291 @@
 
 import (
 	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"image"
-	"math/rand"
+	"math"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
-	"github.com/leotaku/mobi"
 	"github.com/feewg/kaf-cli/internal/model"
+	"github.com/feewg/kaf-cli/internal/render"
+	"github.com/feewg/kaf-cli/internal/utils"
+	"github.com/leotaku/mobi"
+	"github.com/leotaku/mobi/pdb"
+	"github.com/leotaku/mobi/records"
+	"github.com/leotaku/mobi/types"
 	"golang.org/x/text/language"
 )
 
-type Azw3Converter struct {
-	MobiTtmlTitleStart string // AZW3专属标题标签
-	HTMLTitleEnd       string
-	CSSContent         string
-}
+// azw3MaxChapters 单个 azw3 文件的最大章节数
+const azw3MaxChapters = 2000
+
+// Azw3Converter 生成 KF8 格式, 章节 HTML 和样式与 EPUB 相同
+type Azw3Converter struct{}
 
 func NewAzw3Converter() *Azw3Converter {
-	return &Azw3Converter{
-		MobiTtmlTitleStart: `<h3 style="text-align:%s;">`,
-		HTMLTitleEnd:       "</h3>",
-		CSSContent: `
-            .title {text-align: %s}
-            .content { margin-bottom: %s; text-indent: %dem; %s }
-        `,
-	}
+	return &Azw3Converter{}
 }
 
 func (convert Azw3Converter) Build(book model.Book) error {
-	fmt.Println("使用第三方库生成azw3, 不保证所有样式都能正常显示")
 	fmt.Println("正在生成azw3...")
 	start := time.Now()
-	chunks := SectionSliceChunk(book.SectionList, 2000)
-	for i, chunk := range chunks {
-		index := i + 1
-		title := fmt.Sprintf("%s_%d", book.Bookname, index)
-		filename := fmt.Sprintf("%s_%d.azw3", book.Out, index)
-		if len(chunks) == 1 {
-			title = fmt.Sprintf("%s", book.Bookname)
-			filename = fmt.Sprintf("%s.azw3", book.Out)
+	// azw3 章节数过多时无法打开, 超出时按卷拆分
+	for _, book := range book.Parts(model.SplitLimit{Chapters: azw3MaxChapters}) {
+		db, err := convert.realize(book)
+		if err != nil {
+			return err
 		}
-		mb := mobi.Book{
-			Title:       title,
-			Authors:     []string{book.Author},
-			CreatedDate: time.Now(),
-			Chapters:    []mobi.Chapter{},
-			Language:    language.MustParse(book.Lang),
-			UniqueID:    rand.Uint32(),
+		if err := writeDatabase(fmt.Sprintf("%s.azw3", book.Out), db); err != nil {
+			return err
 		}
-		var excss string
-		if book.LineHeight != "" {
-			excss = fmt.Sprintf("line-height: %s;", book.LineHeight)
+	}
+
+	fmt.Println("生成azw3电子书耗时:", time.Now().Sub(start))
+	return nil
+}
+
+// realize 生成 KF8 格式的 PalmDB 数据库, azw3 和 mobi 共用
+func (convert Azw3Converter) realize(book model.Book) (pdb.Database, error) {
+	mb := mobi.Book{
+		Title:       book.Bookname,
+		Authors:     book.Authors(),
+		CreatedDate: utils.SourceDate(),
+		Chapters:    []mobi.Chapter{},
+		Language:    language.MustParse(book.Lang),
+		UniqueID:    book.UniqueID(),
+		Publisher:   book.Publisher,
+	}
+	for _, c := range book.OtherContributors() {
+		mb.Contributors = append(mb.Contributors, c.Name)
+	}
+	mb.PublishedDate, _ = book.PublishedTime()
+
+	res := &kf8Resources{book: &mb, index: make(map[string]int)}
+	r := render.New(book, render.EndNotes, res.image)
+	// 各章节的目录层级, 卷为 0, 卷内章节为 1, 不在目录中显示的页面为 -1
+	var depths []int
+	add := func(title, body string, depth int) {
+		mb.Chapters = append(mb.Chapters, mobi.Chapter{Title: title, Chunks: mobi.Chunks(body)})
+		depths = append(depths, depth)
+	}
+	front, err := r.FrontMatter()
+	if err != nil {
+		return pdb.Database{}, err
+	}
+	for _, page := range front {
+		add(page.Title, page.Body, -1)
+	}
+	chapter := func(section model.Section, isVolume bool, depth int) error {
+		body, err := r.Chapter(section, isVolume)
+		if err != nil {
+			return err
 		}
-		css := fmt.Sprintf(convert.CSSContent, book.Align, book.Bottom, book.Indent, excss)
-		for _, section := range chunk {
-			ch := mobi.Chapter{
-				Title:  section.Title,
-				Chunks: mobi.Chunks(convert.wrapTitle(section.Title, section.Content, book.Align)),
-			}
-			mb.Chapters = append(mb.Chapters, ch)
-			if len(section.Sections) > 0 {
-				for _, subsection := range section.Sections {
-					ch := mobi.Chapter{
-						Title:  subsection.Title,
-						Chunks: mobi.Chunks(convert.wrapTitle(subsection.Title, subsection.Content, book.Align)),
-					}
-					mb.Chapters = append(mb.Chapters, ch)
-				}
+		add(render.PlainTitle(section.Title), body, depth)
+		return nil
+	}
+	for _, section := range book.SectionList {
+		if err := chapter(section, len(section.Sections) > 0, 0); err != nil {
+			return pdb.Database{}, err
+		}
+		for _, subsection := range section.Sections {
+			if err := chapter(subsection, false, 1); err != nil {
+				return pdb.Database{}, err
 			}
 		}
+	}
 
-		mb.CSSFlows = []string{css}
-		if book.Cover != "" {
-			f, err := os.Open(book.Cover)
-			if err != nil {
-				return fmt.Errorf("添加封面失败: %w", err)
-			}
-			img, _, err := image.Decode(f)
-			if err != nil {
-				return fmt.Errorf("添加封面失败: %w", err)
-			}
-			mb.CoverImage = img
+	if book.Cover != "" {
+		img, err := decodeImage(book.Cover)
+		if err != nil {
+			return pdb.Database{}, fmt.Errorf("添加封面失败: %w", err)
+		}
+		mb.CoverImage = img
+	}
+
+	// 字体写在所有图片之后
+	var font []byte
+	var fontURL string
+	if b, _ := utils.IsExists(book.Font); b {
+		data, err := os.ReadFile(book.Font)
+		if err != nil {
+			return pdb.Database{}, fmt.Errorf("添加字体失败: %w", err)
+		}
+		font = data
+		index := len(mb.Images) + 1
+		if mb.CoverImage != nil {
+			index++
 		}
+		fontURL = kindleEmbed(index, fontMime(book.Font))
+	}
+	css, err := render.Stylesheet(book, fontURL)
+	if err != nil {
+		return pdb.Database{}, err
+	}
+	mb.CSSFlows = []string{css}
 
-		// Convert book to PalmDB database
-		db := mb.Realize()
+	// Convert book to PalmDB database
+	db := mb.Realize()
+	if render.IsVertical(book) {
+		setVerticalEXTH(&db)
+	}
+	setMetadataEXTH(&db, book)
+	if err := nestKF8NCX(&db, depths); err != nil {
+		return db, fmt.Errorf("生成目录失败: %w", err)
+	}
+	if font != nil {
+		addKF8Font(&db, font)
+	}
+	return db, nil
+}
 
-		// Write database to file
-		f, _ := os.Create(filename)
-		err := db.Write(f)
+// kf8Resources 收集章节中的图片, 图片按添加顺序从 1 开始编号
+type kf8Resources struct {
+	book  *mobi.Book
+	index map[string]int
+}
+
+// image 添加页眉图片, 返回图片在 KF8 中的地址, 读取不到图片时不显示
+func (res *kf8Resources) image(path string) string {
+	index, ok := res.index[path]
+	if !ok {
+		img, err := decodeImage(path)
 		if err != nil {
-			return fmt.Errorf("保存失败: %w", err)
+			fmt.Println("添加页眉图片失败:", err)
+			return ""
 		}
+		res.book.Images = append(res.book.Images, img)
+		index = len(res.book.Images)
+		res.index[path] = index
 	}
+	return kindleEmbed(index, "image/jpeg")
+}
 
-	fmt.Println("生成azw3电子书耗时:", time.Now().Sub(start))
-	return nil
+// kindleEmbed 返回 KF8 中资源的地址
+func kindleEmbed(index int, mime string) string {
+	return fmt.Sprintf("kindle:embed:%s?mime=%s", records.To32(index), mime)
 }
 
-func (convert Azw3Converter) wrapTitle(title, content, align string) string {
+func fontMime(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".otf":
+		return "application/vnd.ms-opentype"
+	case ".woff":
+		return "application/font-woff"
+	}
+	return "application/x-font-ttf"
+}
+
+// addKF8Font 在图片之后、FDST 之前插入字体记录, 更新之后各记录的序号和资源数量
+func addKF8Font(db *pdb.Database, font []byte) {
+	null := db.Records[0].(records.NullRecord)
+	fdst := int(null.MOBIHeader.LastContentRecordNumberOrFDSTNumberLSB)
+	if null.MOBIHeader.FirstImageIndex == math.MaxUint32 {
+		null.MOBIHeader.FirstImageIndex = uint32(fdst)
+	}
+	count := fdst - int(null.MOBIHeader.FirstImageIndex) + 1
+	null.MOBIHeader.LastContentRecordNumberOrFDSTNumberLSB++
+	null.MOBIHeader.FLISRecordNumber++
+	null.MOBIHeader.FCISRecordNumber++
+	null.EXTHSection = replaceEXTH(null.EXTHSection, types.EXTHKF8CountResources, count)
+	recs := append([]pdb.Record{null}, db.Records[1:fdst]...)
+	recs = append(recs, fontRecord(font))
+	db.Records = append(recs, db.Records[fdst:]...)
+}
+
+// fontRecord 生成 zlib 压缩、不混淆的字体记录
+// 格式: FONT、原始大小、标志、数据位置、混淆密钥长度、混淆密钥位置, 之后是压缩后的字体
+func fontRecord(font []byte) pdb.RawRecord {
 	var buff bytes.Buffer
-	buff.WriteString(fmt.Sprintf(convert.MobiTtmlTitleStart, align))
-	buff.WriteString(title)
-	buff.WriteString(convert.HTMLTitleEnd)
-	buff.WriteString(content)
-	return buff.String()
+	w := zlib.NewWriter(&buff)
+	w.Write(font)
+	w.Close()
+	header := []byte("FONT")
+	for _, v := range []uint32{uint32(len(font)), 1, 24, 0, 24} {
+		header = binary.BigEndian.AppendUint32(header, v)
+	}
+	return append(header, buff.Bytes()...)
 }
 
-func SectionSliceChunk(s []model.Section, size int) [][]model.Section {
-	var ret [][]model.Section
-	for size < len(s) {
-		// s[:size:size] 表示 len 为 size，cap 也为 size，第二个冒号后的 size 表示 cap
-		s, ret = s[size:], append(ret, s[:size:size])
+// replaceEXTH 替换 EXTH 中某一类型的记录, 第三方库不能修改已有的记录, 先写出再重新读取
+func replaceEXTH(exth records.EXTHSection, typ types.EXTHEntryType, values ...int) records.EXTHSection {
+	var buff bytes.Buffer
+	exth.Write(&buff)
+	data := buff.Bytes()
+	ret := records.NewEXTHSection()
+	// EXTH 头: EXTH、长度、记录数, 每条记录: 类型、长度(包括 8 字节的头)、数据
+	count := int(binary.BigEndian.Uint32(data[8:]))
+	p := 12
+	for i := 0; i < count; i++ {
+		t := types.EXTHEntryType(binary.BigEndian.Uint32(data[p:]))
+		l := int(binary.BigEndian.Uint32(data[p+4:]))
+		if t != typ {
+			ret.AddString(t, string(data[p+8:p+l]))
+		}
+		p += l
 	}
-	ret = append(ret, s)
+	ret.AddInt(typ, values...)
 	return ret
 }
+
+// nestKF8NCX 把第三方库生成的单层目录改为按卷嵌套的目录, depths 为各章节的层级
+func nestKF8NCX(db *pdb.Database, depths []int) error {
+	null, ok := db.Records[0].(records.NullRecord)
+	if !ok {
+		return errors.New("不是KF8格式")
+	}
+	idx := int(null.MOBIHeader.INDXRecordOffset)
+	data, ok := db.Records[idx+1].(records.IndexRecord)
+	if !ok || len(data.IDXTEntries) != len(depths) {
+		return errors.New("目录索引与章节不一致")
+	}
+	// 数据记录中每一项为: 标签、控制字节、位置、长度、标题位置、层级
+	// 层级为 -1 的页面(如书名页)不写入目录
+	var entries []ncxEntry
+	for i, raw := range data.IDXTEntries {
+		if depths[i] < 0 {
+			continue
+		}
+		pos := 1 + int(raw[0]) + 1
+		var vals [3]int
+		for j := range vals {
+			v, n := decodeVwi(raw[pos:])
+			vals[j] = v
+			pos += n
+		}
+		entries = append(entries, ncxEntry{Offset: vals[0], Length: vals[1], Name: vals[2], Depth: depths[i]})
+	}
+	header, ncx := ncxIndexRecords(nestNCX(entries), 1)
+	db.ReplaceRecord(idx, header)
+	db.ReplaceRecord(idx+1, ncx)
+	return nil
+}
+
+// decodeImage 读取图片文件
+func decodeImage(filename string) (image.Image, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// writeDatabase 把 PalmDB 数据库写入文件
+func writeDatabase(filename string, db pdb.Database) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("保存失败: %w", err)
+	}
+	defer f.Close()
+	if err := db.Write(f); err != nil {
+		return fmt.Errorf("保存失败: %w", err)
+	}
+	return f.Close()
+}
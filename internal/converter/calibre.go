@@ -0,0 +1,144 @@
+package converter
+
+import (
+	"fmt"
+	"html"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/feewg/kaf-cli/internal/model"
+)
+
+// writeCalibreMetadata 在输出目录写入 Calibre 使用的元数据和封面
+// Calibre 导入或 calibredb add 时会直接读取这两个文件
+func writeCalibreMetadata(book model.Book) error {
+	dir := filepath.Dir(book.Out)
+	opfName, coverName := calibreFileNames(book)
+	var cover string
+	if book.Cover != "" {
+		if err := copyCalibreCover(book.Cover, filepath.Join(dir, coverName)); err != nil {
+			fmt.Println("写入 Calibre 封面失败:", err)
+		} else {
+			cover = coverName
+		}
+	}
+	opf := calibreOPF(book, cover)
+	opfPath := filepath.Join(dir, opfName)
+	if err := os.WriteFile(opfPath, []byte(opf), 0644); err != nil {
+		return fmt.Errorf("写入 %s 失败: %w", opfName, err)
+	}
+	fmt.Println("已生成 Calibre 元数据:", opfPath)
+	return nil
+}
+
+// calibreFileNames 元数据和封面的文件名
+// calibre 目录结构下每本书单独一个目录, 使用 Calibre 默认的 metadata.opf 和 cover.jpg;
+// 其他情况下多本书或多册输出到同一目录, 按书名命名避免互相覆盖
+func calibreFileNames(book model.Book) (opf, cover string) {
+	if book.OutputLayout == "calibre" {
+		return "metadata.opf", "cover.jpg"
+	}
+	name := filepath.Base(book.Out)
+	return name + ".opf", name + ".jpg"
+}
+
+// calibreOPF 生成 OPF 2.0 格式的元数据, 与 Calibre 自身导出的 metadata.opf 保持一致
+// cover 为封面文件名, 没有封面时为空
+func calibreOPF(book model.Book, cover string) string {
+	var buff strings.Builder
+	line := func(format string, args ...any) {
+		buff.WriteString("    ")
+		fmt.Fprintf(&buff, format, args...)
+		buff.WriteString("\n")
+	}
+	buff.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	buff.WriteString(`<package xmlns="http://www.idpf.org/2007/opf" unique-identifier="uuid_id" version="2.0">` + "\n")
+	buff.WriteString(`  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">` + "\n")
+	line(`<dc:identifier opf:scheme="uuid" id="uuid_id">%s</dc:identifier>`, html.EscapeString(strings.TrimPrefix(book.UID(), "urn:uuid:")))
+	line(`<dc:title>%s</dc:title>`, html.EscapeString(book.Bookname))
+	for _, author := range book.Authors() {
+		line(`<dc:creator opf:role="%s">%s</dc:creator>`, model.RoleAuthor, html.EscapeString(author))
+	}
+	for _, c := range book.OtherContributors() {
+		line(`<dc:contributor opf:role="%s">%s</dc:contributor>`, c.Role, html.EscapeString(c.Name))
+	}
+	if book.Description != "" {
+		line(`<dc:description>%s</dc:description>`, html.EscapeString(book.Description))
+	}
+	if book.Publisher != "" {
+		line(`<dc:publisher>%s</dc:publisher>`, html.EscapeString(book.Publisher))
+	}
+	if book.PubDate != "" {
+		line(`<dc:date>%s</dc:date>`, html.EscapeString(book.PubDate))
+	}
+	line(`<dc:language>%s</dc:language>`, html.EscapeString(book.Lang))
+	for _, tag := range book.TagList() {
+		line(`<dc:subject>%s</dc:subject>`, html.EscapeString(tag))
+	}
+	for _, id := range book.IdentifierList() {
+		line(`<dc:identifier opf:scheme="%s">%s</dc:identifier>`, html.EscapeString(strings.ToUpper(id.Scheme)), html.EscapeString(id.Value))
+	}
+	if book.Series != "" {
+		line(`<meta name="calibre:series" content="%s"/>`, html.EscapeString(book.Series))
+		if book.SeriesIndex != "" {
+			line(`<meta name="calibre:series_index" content="%s"/>`, html.EscapeString(book.SeriesIndex))
+		}
+	}
+	buff.WriteString("  </metadata>\n")
+	if cover != "" {
+		buff.WriteString("  <guide>\n")
+		line(`<reference type="cover" title="封面" href="%s"/>`, html.EscapeString(cover))
+		buff.WriteString("  </guide>\n")
+	}
+	buff.WriteString("</package>\n")
+	return buff.String()
+}
+
+// copyCalibreCover 复制封面到 dst, 非 jpg 格式的封面重新编码为 jpg
+// 封面已经在 dst 时不做处理; 先写临时文件再重命名, 失败时不会破坏已有的文件
+func copyCalibreCover(src, dst string) error {
+	absSrc, err := filepath.Abs(src)
+	if err != nil {
+		return err
+	}
+	absDst, err := filepath.Abs(dst)
+	if err != nil {
+		return err
+	}
+	if absSrc == absDst {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(filepath.Dir(dst), ".kaf-cover-*.jpg")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	switch strings.ToLower(filepath.Ext(src)) {
+	case ".jpg", ".jpeg":
+		_, err = io.Copy(out, in)
+	default:
+		var img image.Image
+		if img, _, err = image.Decode(in); err == nil {
+			err = jpeg.Encode(out, img, &jpeg.Options{Quality: 90})
+		}
+	}
+	if err == nil {
+		err = out.Chmod(0644)
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), dst)
+}
@@ -0,0 +1,68 @@
+package converter_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/feewg/kaf-cli/internal/converter"
+	"github.com/feewg/kaf-cli/internal/core"
+	"github.com/feewg/kaf-cli/internal/model"
+)
+
+// convertBook 按命令行的流程把 txt 转换为 EPUB 并生成 Calibre 元数据
+func convertBook(t *testing.T, filename, out string) {
+	t.Helper()
+	book, err := model.NewBookSimple(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	book.Format = "epub"
+	book.Cover = "local"
+	book.CalibreMetadata = true
+	book.Out = out
+	if err := core.Check(book, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.Parse(book); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&converter.Dispatcher{Book: book}).Convert(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCalibreMetadataSameDir 两本书输出到同一目录时各自生成元数据和封面, 不会互相覆盖
+func TestCalibreMetadataSameDir(t *testing.T) {
+	src, out := t.TempDir(), t.TempDir()
+	books := []string{"第一本", "第二本"}
+	for _, name := range books {
+		filename := filepath.Join(src, name+".txt")
+		content := "书名：" + name + "\n作者：作者\n\n第一章 开始\n正文。\n"
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		convertBook(t, filename, filepath.Join(out, name))
+	}
+	for _, name := range books {
+		opf, err := os.ReadFile(filepath.Join(out, name+".opf"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(opf), "<dc:title>"+name+"</dc:title>") {
+			t.Errorf("%s.opf 中的书名错误:\n%s", name, opf)
+		}
+		if !strings.Contains(string(opf), `href="`+name+`.jpg"`) {
+			t.Errorf("%s.opf 中的封面错误:\n%s", name, opf)
+		}
+		for _, ext := range []string{".epub", ".jpg"} {
+			if _, err := os.Stat(filepath.Join(out, name+ext)); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(out, "metadata.opf")); !os.IsNotExist(err) {
+		t.Errorf("flat 目录结构下不应生成共用的 metadata.opf")
+	}
+}
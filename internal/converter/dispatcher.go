@@ -2,6 +2,8 @@
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/feewg/kaf-cli/internal/model"
@@ -14,11 +16,36 @@ type Dispatcher struct {
 
 func (d *Dispatcher) Convert() error {
 	start := time.Now()
+	defer d.Book.Cleanup()
+	// 按上限拆分为多册
+	parts := d.Book.Parts(d.Book.SplitLimit())
+	if len(parts) > 1 {
+		fmt.Printf("拆分为 %d 册\n", len(parts))
+	}
+	for _, part := range parts {
+		if err := d.build(part); err != nil {
+			return err
+		}
+	}
+	end := time.Now().Sub(start)
+	fmt.Println("\n转换完成! 总耗时:", end)
+
+	return nil
+}
+
+// build 生成一册书籍的所有格式
+func (d *Dispatcher) build(book model.Book) error {
+	// 创建输出目录
+	if dir := filepath.Dir(book.Out); dir != "" && dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("创建输出目录失败: %w", err)
+		}
+	}
 	// 解析文本
 	fmt.Println()
 	// 判断要生成的格式
 	var isEpub, isMobi, isAzw3 bool
-	switch d.Book.Format {
+	switch book.Format {
 	case "epub":
 		isEpub = true
 	case "mobi":
@@ -33,7 +60,7 @@ func (d *Dispatcher) Convert() error {
 	}
 
 	hasKinldegen := utils.LookKindlegen()
-	if d.Book.Format == "mobi" && hasKinldegen == "" {
+	if book.Format == "mobi" && hasKinldegen == "" {
 		isEpub = false
 	}
 
@@ -41,26 +68,35 @@ func (d *Dispatcher) Convert() error {
 	// 生成epub
 	if isEpub {
 		convert = NewEpubConverter()
-		convert.Build(*d.Book)
+		if err := convert.Build(book); err != nil {
+			return err
+		}
 		fmt.Println()
 	}
 	// 生成azw3格式
 	if isAzw3 {
 		convert = NewAzw3Converter()
 		// 生成kindle格式
-		convert.Build(*d.Book)
+		if err := convert.Build(book); err != nil {
+			return err
+		}
 	}
 	// 生成mobi格式
 	if isMobi {
 		if hasKinldegen == "" {
 			convert = NewMobiConverter()
-			convert.Build(*d.Book)
+			if err := convert.Build(book); err != nil {
+				return err
+			}
 		} else {
-			ConverToMobi(fmt.Sprintf("%s.epub", d.Book.Out), d.Book.Lang)
+			ConverToMobi(fmt.Sprintf("%s.epub", book.Out), book.Lang)
+		}
+	}
+	// 生成 Calibre 元数据
+	if book.CalibreMetadata {
+		if err := writeCalibreMetadata(book); err != nil {
+			return err
 		}
 	}
-	end := time.Now().Sub(start)
-	fmt.Println("\n转换完成! 总耗时:", end)
-
 	return nil
 }
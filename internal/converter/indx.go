@@ -0,0 +1,162 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/leotaku/mobi/pdb"
+	"github.com/leotaku/mobi/records"
+	t "github.com/leotaku/mobi/types"
+)
+
+// ncxTAGX 带层级关系的目录索引标签
+var ncxTAGX = t.TAGXTagTable{
+	t.TAGXTagEntryPosition,
+	t.TAGXTagEntryLength,
+	t.TAGXTagEntryNameOffset,
+	t.TAGXTagEntryDepthLevel,
+	t.TAGXTagEntryParent,
+	t.TAGXTagEntryChild1,
+	t.TAGXTagEntryChildN,
+	t.TAGXTagEnd,
+}
+
+// ncxEntry MOBI 目录索引中的一项
+type ncxEntry struct {
+	Offset int // 正文中的位置
+	Length int // 正文长度
+	Name   int // 标题在 CNCX 记录中的位置
+	Depth  int // 层级, 顶层为 0
+
+	parent, child1, childN int // 排序后的序号, 没有时为 -1
+}
+
+// nestNCX 按层级排列目录项并填写父子关系, entries 按正文顺序排列
+// Kindle 要求目录索引先列出所有顶层项, 再依次列出下一层的项
+func nestNCX(entries []ncxEntry) []ncxEntry {
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return entries[order[a]].Depth < entries[order[b]].Depth
+	})
+	index := make([]int, len(entries))
+	ret := make([]ncxEntry, len(entries))
+	for i, o := range order {
+		index[o] = i
+		ret[i] = entries[o]
+		ret[i].parent, ret[i].child1, ret[i].childN = -1, -1, -1
+	}
+	// 按正文顺序记录每一层最近的目录项
+	var parents []int
+	for i, e := range entries {
+		parents = parents[:min(e.Depth, len(parents))]
+		if len(parents) > 0 {
+			p := index[parents[len(parents)-1]]
+			ret[index[i]].parent = p
+			if ret[p].child1 < 0 {
+				ret[p].child1 = index[i]
+			}
+			ret[p].childN = index[i]
+		}
+		parents = append(parents, i)
+	}
+	return ret
+}
+
+// ncxIndexRecords 生成目录索引的头记录和数据记录
+func ncxIndexRecords(entries []ncxEntry, cncxCount int) (records.IndexRecord, records.IndexRecord) {
+	// 标签按字符串排序, 使用相同的宽度
+	width := max(3, len(strconv.Itoa(len(entries)-1)))
+	label := func(i int) []byte {
+		s := fmt.Sprintf("%0*d", width, i)
+		return append([]byte{byte(len(s))}, s...)
+	}
+	idxt := make([][]byte, len(entries))
+	for i, e := range entries {
+		cb := t.CBNCXSingle
+		if e.parent >= 0 {
+			cb |= t.CBNCXChild
+		}
+		if e.child1 >= 0 {
+			cb |= t.CBNCXParent
+		}
+		bs := append(label(i), cb)
+		for _, v := range []int{e.Offset, e.Length, e.Name, e.Depth} {
+			bs = append(bs, encodeVwi(v)...)
+		}
+		if e.parent >= 0 {
+			bs = append(bs, encodeVwi(e.parent)...)
+		}
+		if e.child1 >= 0 {
+			bs = append(bs, encodeVwi(e.child1)...)
+			bs = append(bs, encodeVwi(e.childN)...)
+		}
+		idxt[i] = bs
+	}
+	last := binary.BigEndian.AppendUint16(label(len(entries)-1), uint16(len(entries)))
+	header := records.IndexRecord{
+		TAGXTable:     ncxTAGX,
+		Type:          2,
+		IDXTEntries:   [][]byte{last},
+		SubEntryCount: uint32(len(entries)),
+		CNCXCount:     uint32(cncxCount),
+	}
+	data := records.IndexRecord{
+		Type:        0,
+		HeaderType:  1,
+		IDXTEntries: idxt,
+	}
+	return header, data
+}
+
+// cncxRecords 把目录标题写入 CNCX 记录, 返回每个标题的位置(记录序号<<16 | 记录内偏移)
+func cncxRecords(titles []string) ([]pdb.Record, []int) {
+	// 单条记录内的偏移只有 16 位, 超出时写入下一条记录
+	const limit = 0x10000 - 1024
+	var recs []pdb.Record
+	var buff bytes.Buffer
+	flush := func() {
+		for buff.Len()%4 != 0 {
+			buff.WriteByte(0)
+		}
+		recs = append(recs, pdb.RawRecord(bytes.Clone(buff.Bytes())))
+		buff.Reset()
+	}
+	offsets := make([]int, len(titles))
+	for i, title := range titles {
+		s := append(encodeVwi(len(title)), title...)
+		if buff.Len() > 0 && buff.Len()+len(s) > limit {
+			flush()
+		}
+		offsets[i] = len(recs)<<16 | buff.Len()
+		buff.Write(s)
+	}
+	flush()
+	return recs, offsets
+}
+
+// encodeVwi 编码变长整数, 每字节 7 位, 最后一个字节的最高位为 1
+func encodeVwi(x int) []byte {
+	bs := []byte{byte(x&0x7f) | 0x80}
+	for x >>= 7; x > 0; x >>= 7 {
+		bs = append([]byte{byte(x & 0x7f)}, bs...)
+	}
+	return bs
+}
+
+// decodeVwi 解码变长整数, 返回数值和占用的字节数
+func decodeVwi(data []byte) (int, int) {
+	var x int
+	for i, b := range data {
+		x = x<<7 | int(b&0x7f)
+		if b&0x80 != 0 {
+			return x, i + 1
+		}
+	}
+	return x, len(data)
+}
@@ -0,0 +1,170 @@
+package converter
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/feewg/kaf-cli/internal/model"
+	"github.com/feewg/kaf-cli/internal/utils"
+	"github.com/leotaku/mobi/pdb"
+	"github.com/leotaku/mobi/records"
+	"github.com/leotaku/mobi/types"
+)
+
+// epubMetadata 生成 go-epub 不支持的 OPF 元数据：其他作者和译者、出版社、出版日期、标签、标识符和系列
+// 第一作者由 go-epub 写入, 系列同时写入 EPUB3 的 belongs-to-collection 和 Calibre 的 calibre:series
+func epubMetadata(book model.Book) string {
+	var buff strings.Builder
+	line := func(format string, args ...any) {
+		buff.WriteString("    ")
+		fmt.Fprintf(&buff, format, args...)
+		buff.WriteString("\n")
+	}
+	for i, author := range book.Authors() {
+		if i == 0 {
+			continue
+		}
+		line(`<dc:creator id="creator-%d">%s</dc:creator>`, i+1, html.EscapeString(author))
+		line(`<meta refines="#creator-%d" property="role" scheme="marc:relators">%s</meta>`, i+1, model.RoleAuthor)
+	}
+	for i, c := range book.OtherContributors() {
+		line(`<dc:contributor id="contributor-%d">%s</dc:contributor>`, i+1, html.EscapeString(c.Name))
+		line(`<meta refines="#contributor-%d" property="role" scheme="marc:relators">%s</meta>`, i+1, c.Role)
+	}
+	if book.Publisher != "" {
+		line(`<dc:publisher>%s</dc:publisher>`, html.EscapeString(book.Publisher))
+	}
+	if book.PubDate != "" {
+		line(`<dc:date>%s</dc:date>`, html.EscapeString(book.PubDate))
+	}
+	for _, tag := range book.TagList() {
+		line(`<dc:subject>%s</dc:subject>`, html.EscapeString(tag))
+	}
+	for i, id := range book.IdentifierList() {
+		value := id.Scheme + ":" + id.Value
+		if id.Scheme == "isbn" {
+			value = "urn:isbn:" + id.Value
+		}
+		line(`<dc:identifier id="id-%d">%s</dc:identifier>`, i+1, html.EscapeString(value))
+	}
+	if book.Series != "" {
+		series := html.EscapeString(book.Series)
+		line(`<meta property="belongs-to-collection" id="series">%s</meta>`, series)
+		line(`<meta refines="#series" property="collection-type">series</meta>`)
+		if book.SeriesIndex != "" {
+			line(`<meta refines="#series" property="group-position">%s</meta>`, html.EscapeString(book.SeriesIndex))
+		}
+		line(`<meta name="calibre:series" content="%s"/>`, series)
+		if book.SeriesIndex != "" {
+			line(`<meta name="calibre:series_index" content="%s"/>`, html.EscapeString(book.SeriesIndex))
+		}
+	}
+	return buff.String()
+}
+
+var modifiedReg = regexp.MustCompile(`<meta property="dcterms:modified">[^<]*</meta>`)
+
+// patchEpubMetadata 把 go-epub 不支持的元数据写入已生成的 EPUB
+// 修改时间改为 utils.SourceDate, 设置 SOURCE_DATE_EPOCH 时重复转换得到相同的文件
+func patchEpubMetadata(filename string, book model.Book) error {
+	extra := epubMetadata(book)
+	modified := fmt.Sprintf(`<meta property="dcterms:modified">%s</meta>`, utils.SourceDate().Format("2006-01-02T15:04:05Z"))
+	return rewriteEpub(filename, func(name string, data []byte) []byte {
+		if !strings.HasSuffix(name, ".opf") {
+			return data
+		}
+		data = modifiedReg.ReplaceAll(data, []byte(modified))
+		return bytes.Replace(data, []byte("  </metadata>"), []byte(extra+"  </metadata>"), 1)
+	})
+}
+
+// rewriteEpub 按原顺序重写 EPUB 中的文件，mimetype 保持为不压缩的第一个文件
+func rewriteEpub(filename string, patch func(name string, data []byte) []byte) error {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filename), ".kaf-*.epub")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := zip.NewWriter(tmp)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		header := &zip.FileHeader{Name: f.Name, Method: f.Method, Modified: f.Modified}
+		if f.Name == "mimetype" {
+			// 设置修改时间时会写入扩展时间戳字段, epubcheck 不允许 mimetype 有扩展字段
+			header.Method = zip.Store
+			header.Modified = time.Time{}
+		}
+		fw, err := w.CreateHeader(header)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		if _, err := fw.Write(patch(f.Name, data)); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	// 临时文件的权限为 0600, 重命名前恢复原文件的权限
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	r.Close()
+	return os.Rename(tmp.Name(), filename)
+}
+
+// setMetadataEXTH 为 KF8 书籍写入简介、ISBN 和标签的 EXTH 记录
+// 出版社和出版日期由 mobi.Book 写入, Kindle 没有系列对应的 EXTH 记录
+func setMetadataEXTH(db *pdb.Database, book model.Book) {
+	null, ok := db.Records[0].(records.NullRecord)
+	if !ok {
+		return
+	}
+	addMetadataEXTH(&null.EXTHSection, book)
+	db.ReplaceRecord(0, null)
+}
+
+// addMetadataEXTH 写入简介、ISBN 和标签
+func addMetadataEXTH(exth *records.EXTHSection, book model.Book) {
+	exth.AddString(types.EXTHDescription, book.Description)
+	for _, id := range book.IdentifierList() {
+		if id.Scheme == "isbn" {
+			exth.AddString(types.EXTHISBN, id.Value)
+		}
+	}
+	exth.AddString(types.EXTHSubject, book.TagList()...)
+}
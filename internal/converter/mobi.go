@@ -4,50 +4,49 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/766b/mobi"
 	"github.com/feewg/kaf-cli/internal/model"
+	"github.com/feewg/kaf-cli/internal/utils"
+	"github.com/leotaku/mobi/pdb"
+	"github.com/leotaku/mobi/records"
+	"github.com/leotaku/mobi/types"
 )
 
-type MobiConverter struct {
-	HTMLPStart     string // MOBI专属段落标签
-	HTMLPEnd       string
-	HTMLTitleStart string
-	HTMLTitleEnd   string
-}
+type MobiConverter struct{}
 
 func NewMobiConverter() *MobiConverter {
-	return &MobiConverter{
-		HTMLPStart:     `<p class="content">`,
-		HTMLPEnd:       "</p>",
-		HTMLTitleStart: `<h3 class="title">`,
-		HTMLTitleEnd:   "</h3>",
-	}
+	return &MobiConverter{}
 }
 
+// Build 生成同时包含 MOBI7 和 KF8 的 mobi 文件, 不需要 kindlegen
+// 旧款 Kindle 读取 MOBI7 部分, 新款 Kindle 读取与 azw3 相同的 KF8 部分
 func (convert MobiConverter) Build(book model.Book) error {
-	fmt.Println("使用第三方库生成mobi, 不保证所有样式都能正常显示")
 	fmt.Println("正在生成mobi...")
 	start := time.Now()
-	m, err := mobi.NewWriter(fmt.Sprintf("%s.mobi", book.Out))
-	if err != nil {
-		panic(err)
-	}
-	m.Title(book.Bookname)
-	m.Compression(mobi.CompressionNone)
-	if book.Cover != "" {
-		m.AddCover(book.Cover, book.Cover)
-	}
-	m.NewExthRecord(mobi.EXTH_DOCTYPE, "EBOK")
-	m.NewExthRecord(mobi.EXTH_AUTHOR, book.Author)
-	for _, section := range book.SectionList {
-		m.NewChapter(section.Title, []byte(section.Content))
-		if len(section.Sections) > 0 {
-			for _, subsection := range section.Sections {
-				m.NewChapter(subsection.Title, []byte(subsection.Content))
-			}
+	// KF8 部分与 azw3 的章节数限制相同
+	for _, book := range book.Parts(model.SplitLimit{Chapters: azw3MaxChapters}) {
+		kf8, err := NewAzw3Converter().realize(book)
+		if err != nil {
+			return err
+		}
+		locale := kf8.Records[0].(records.NullRecord).MOBIHeader.Locale
+		mobi7, err := mobi7Records(book, locale)
+		if err != nil {
+			return err
+		}
+		// MOBI7 记录之后是 BOUNDARY 记录, 然后是 KF8 的记录, EXTH 121 指向 KF8 的第一条记录
+		// 图片在两部分各写一份: KF8 部分与 azw3 相同, FirstImageIndex 等记录序号都相对于 KF8 的第一条记录,
+		// kindlegen 让 KF8 共用 MOBI7 部分的图片, 但阅读器如何定位这些图片没有公开文档, 也无法在设备上验证,
+		// 拆分出 KF8 部分的工具还会丢失图片, 因此以文件变大为代价保证两部分都能独立显示图片
+		null := mobi7[0].(mobi7NullRecord)
+		null.EXTHSection.AddInt(types.EXTHKF8Boundary, len(mobi7)+1)
+		mobi7[0] = null
+		db := pdb.NewDatabase(book.Bookname, utils.SourceDate())
+		db.Records = append(mobi7, pdb.RawRecord("BOUNDARY"))
+		db.Records = append(db.Records, kf8.Records...)
+		if err := writeDatabase(fmt.Sprintf("%s.mobi", book.Out), db); err != nil {
+			return err
 		}
 	}
-	m.Write()
 	fmt.Println("生成mobi电子书耗时:", time.Now().Sub(start))
 	return nil
 }
@@ -0,0 +1,500 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"html"
+	"image"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/feewg/kaf-cli/internal/model"
+	"github.com/feewg/kaf-cli/internal/render"
+	"github.com/leotaku/mobi/pdb"
+	"github.com/leotaku/mobi/records"
+	t "github.com/leotaku/mobi/types"
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/text/language"
+)
+
+// mobi7RecordSize MOBI7 正文记录的大小
+const mobi7RecordSize = 4096
+
+// mobi7NullRecord MOBI7 的第一条记录, 与 KF8 的区别是 MOBI 头中没有 KF8 的索引字段
+type mobi7NullRecord struct {
+	PalmDocHeader t.PalmDocHeader
+	MOBIHeader    t.MOBIHeader
+	FullName      string
+	EXTHSection   records.EXTHSection
+}
+
+func (n mobi7NullRecord) Write(w io.Writer) error {
+	n.MOBIHeader.FullNameOffset = uint32(t.PalmDocHeaderLength + t.MOBIHeaderLength + n.EXTHSection.Length())
+	n.MOBIHeader.FullNameLength = uint32(len(n.FullName))
+	if err := binary.Write(w, pdb.Endian, n.PalmDocHeader); err != nil {
+		return err
+	}
+	if err := binary.Write(w, pdb.Endian, n.MOBIHeader); err != nil {
+		return err
+	}
+	if err := n.EXTHSection.Write(w); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, n.FullName); err != nil {
+		return err
+	}
+	_, err := w.Write(make([]byte, records.NullPaddingLength))
+	return err
+}
+
+// mobi7Records 生成 MOBI7 部分的记录, 不支持 KF8 的旧款 Kindle 使用这一部分
+// 正文由 EPUB 的章节 HTML 转换为 MOBI7 支持的标签, 目录和封面与 KF8 部分一致
+func mobi7Records(book model.Book, locale uint32) ([]pdb.Record, error) {
+	text := &mobi7Text{
+		book:       book,
+		anchors:    make(map[string]int),
+		imageIndex: make(map[string]int),
+	}
+	if book.Cover != "" {
+		img, err := decodeImage(book.Cover)
+		if err != nil {
+			return nil, fmt.Errorf("添加封面失败: %w", err)
+		}
+		text.images = append(text.images, img)
+	}
+	data, chapters, err := text.build()
+	if err != nil {
+		return nil, err
+	}
+
+	null := mobi7NullRecord{
+		PalmDocHeader: t.NewPalmDocHeader(),
+		MOBIHeader:    t.NewMOBIHeader(),
+		FullName:      book.Bookname,
+		EXTHSection:   mobi7EXTH(book, book.Cover != ""),
+	}
+	null.MOBIHeader.UniqueID = book.UniqueID()
+	null.MOBIHeader.Locale = locale
+	// 只有多字节字符的尾部数据, 没有 TBS 索引
+	null.MOBIHeader.ExtraRecordDataFlags = 1
+
+	recs := []pdb.Record{nil}
+	textRecords := mobi7TextRecords(data)
+	recs = append(recs, textRecords...)
+	null.PalmDocHeader.TextLength = uint32(len(data))
+	null.PalmDocHeader.TextRecordCount = uint16(len(textRecords))
+	null.MOBIHeader.FirstNonBookIndex = uint32(len(recs))
+
+	// 目录索引
+	if len(chapters) > 0 {
+		titles := make([]string, len(chapters))
+		for i, ch := range chapters {
+			titles[i] = ch.Title
+		}
+		cncx, offsets := cncxRecords(titles)
+		entries := make([]ncxEntry, len(chapters))
+		for i, ch := range chapters {
+			entries[i] = ncxEntry{Offset: ch.Offset, Length: ch.Length, Name: offsets[i], Depth: ch.Depth}
+		}
+		header, ncx := ncxIndexRecords(nestNCX(entries), len(cncx))
+		null.MOBIHeader.INDXRecordOffset = uint32(len(recs))
+		recs = append(recs, header, ncx)
+		recs = append(recs, cncx...)
+	}
+
+	// 图片, 封面为第一张
+	if len(text.images) > 0 {
+		null.MOBIHeader.FirstImageIndex = uint32(len(recs))
+	}
+	for _, img := range text.images {
+		recs = append(recs, records.NewImageRecord(img))
+	}
+	null.MOBIHeader.LastContentRecordNumberOrFDSTNumberLSB = uint16(len(recs) - 1)
+
+	null.MOBIHeader.FLISRecordNumber = uint32(len(recs))
+	null.MOBIHeader.FLISRecordCount = 1
+	recs = append(recs, t.NewFLISRecord())
+	null.MOBIHeader.FCISRecordNumber = uint32(len(recs))
+	null.MOBIHeader.FCISRecordCount = 1
+	recs = append(recs, t.NewFCISRecord(uint32(len(data))))
+
+	recs[0] = null
+	return recs, nil
+}
+
+// mobi7EXTH 生成 MOBI7 的元数据, 与 KF8 部分写入的内容一致
+func mobi7EXTH(book model.Book, hasCover bool) records.EXTHSection {
+	exth := records.NewEXTHSection()
+	exth.AddString(t.EXTHTitle, book.Bookname)
+	exth.AddString(t.EXTHUpdatedTitle, book.Bookname)
+	exth.AddString(t.EXTHAuthor, book.Authors()...)
+	for _, c := range book.OtherContributors() {
+		exth.AddString(t.EXTHContributor, c.Name)
+	}
+	exth.AddString(t.EXTHPublisher, book.Publisher)
+	if date, err := book.PublishedTime(); err == nil && !date.IsZero() {
+		exth.AddString(t.EXTHPublishingDate, date.Format(time.RFC3339))
+	}
+	// 与 KF8 部分使用相同的 ASIN, Kindle 才会当作同一本书
+	exth.AddString(t.EXTHASIN, fmt.Sprintf("%015x", book.UniqueID()))
+	if base, _ := language.MustParse(book.Lang).Base(); base.String() != "und" {
+		exth.AddString(t.EXTHLanguage, base.String())
+	}
+	exth.AddString(t.EXTHDocType, "EBOK")
+	addMetadataEXTH(&exth, book)
+	if hasCover {
+		exth.AddInt(t.EXTHCoverOffset, 0)
+		exth.AddInt(t.EXTHHasFakeCover, 0)
+	}
+	return exth
+}
+
+// mobi7TextRecords 把正文按 4096 字节拆分为记录
+// 拆开的多字节字符在记录末尾写入剩余的字节, 最后一个字节为剩余字节数
+func mobi7TextRecords(data []byte) []pdb.Record {
+	var recs []pdb.Record
+	for start := 0; start < len(data); start += mobi7RecordSize {
+		end := min(start+mobi7RecordSize, len(data))
+		rec := bytes.Clone(data[start:end])
+		var overlap int
+		for end+overlap < len(data) && overlap < 3 && !utf8.RuneStart(data[end+overlap]) {
+			overlap++
+		}
+		rec = append(rec, data[end:end+overlap]...)
+		rec = append(rec, byte(overlap))
+		recs = append(recs, pdb.RawRecord(rec))
+	}
+	return recs
+}
+
+// mobi7Chapter MOBI7 目录中的一项
+type mobi7Chapter struct {
+	Title  string
+	Depth  int
+	Offset int
+	Length int
+	key    string
+}
+
+// mobi7Link 需要回填 filepos 的链接
+type mobi7Link struct {
+	pos            int
+	target, anchor string // 目标锚点, 找不到时使用 anchor
+}
+
+// mobi7Text 生成 MOBI7 的正文
+// MOBI7 不支持 CSS, 样式转换为标签属性; 链接使用正文中的字节位置, 生成正文后回填
+type mobi7Text struct {
+	book       model.Book
+	buff       bytes.Buffer
+	anchors    map[string]int
+	links      []mobi7Link
+	pages      int
+	images     []image.Image
+	imageIndex map[string]int // 图片路径对应的 recindex
+}
+
+const (
+	mobi7TocKey   = "toc"
+	mobi7StartKey = "start"
+)
+
+// build 生成正文, 返回正文和目录
+func (text *mobi7Text) build() ([]byte, []mobi7Chapter, error) {
+	book := text.book
+	var chapters []mobi7Chapter
+	for i, section := range book.SectionList {
+		chapters = append(chapters, mobi7Chapter{Title: render.PlainTitle(section.Title), key: fmt.Sprintf("ch%d", i)})
+		for j, sub := range section.Sections {
+			chapters = append(chapters, mobi7Chapter{Title: render.PlainTitle(sub.Title), Depth: 1, key: fmt.Sprintf("ch%d-%d", i, j)})
+		}
+	}
+
+	title := navLabel(book.Lang, "toc")
+	text.buff.WriteString("<html><head><guide>")
+	fmt.Fprintf(&text.buff, `<reference type="toc" title="%s" `, html.EscapeString(title))
+	text.link(mobi7TocKey, "")
+	text.buff.WriteString(" />")
+	fmt.Fprintf(&text.buff, `<reference type="text" title="%s" `, html.EscapeString(navLabel(book.Lang, "start")))
+	text.link(mobi7StartKey, "")
+	text.buff.WriteString(" /></guide></head><body>")
+
+	// MOBI7 不支持竖排, 按横排渲染; 页眉图片使用图片路径, 转换时读取图片
+	book.WritingMode = "horizontal"
+	r := render.New(book, render.EndNotes, html.EscapeString)
+	front, err := r.FrontMatter()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, page := range front {
+		text.pagebreak()
+		text.convert(page.Name, page.Body)
+	}
+	if book.TocPage {
+		text.tocPage(title, chapters)
+	}
+	var n int
+	for _, section := range book.SectionList {
+		body, err := r.Chapter(section, len(section.Sections) > 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		text.chapter(chapters[n].key, section, body)
+		n++
+		for _, sub := range section.Sections {
+			body, err := r.Chapter(sub, false)
+			if err != nil {
+				return nil, nil, err
+			}
+			text.chapter(chapters[n].key, sub, body)
+			n++
+		}
+	}
+	end := text.buff.Len()
+	if !book.TocPage {
+		text.tocPage(title, chapters)
+	}
+	text.buff.WriteString("</body></html>")
+
+	// 回填链接位置
+	data := text.buff.Bytes()
+	for _, l := range text.links {
+		pos, ok := text.anchors[l.target]
+		if !ok {
+			pos = text.anchors[l.anchor]
+		}
+		copy(data[l.pos:], fmt.Sprintf("%010d", pos))
+	}
+	for i := range chapters {
+		chapters[i].Offset = text.anchors[chapters[i].key]
+		next := end
+		if i+1 < len(chapters) {
+			next = text.anchors[chapters[i+1].key]
+		}
+		chapters[i].Length = next - chapters[i].Offset
+	}
+	return data, chapters, nil
+}
+
+// pagebreak 每一页之前分页
+func (text *mobi7Text) pagebreak() {
+	if text.pages > 0 {
+		text.buff.WriteString("<mbp:pagebreak/>")
+	}
+	text.pages++
+}
+
+// link 写入 filepos 属性, 位置在生成正文后回填
+func (text *mobi7Text) link(target, anchor string) {
+	text.buff.WriteString("filepos=")
+	text.links = append(text.links, mobi7Link{pos: text.buff.Len(), target: target, anchor: anchor})
+	text.buff.WriteString("0000000000")
+}
+
+// anchor 记录锚点位置, 同名的锚点只记录第一个
+func (text *mobi7Text) anchor(key string) {
+	if _, ok := text.anchors[key]; !ok {
+		text.anchors[key] = text.buff.Len()
+	}
+}
+
+// tocPage 生成目录页, 卷内章节缩进显示
+func (text *mobi7Text) tocPage(title string, chapters []mobi7Chapter) {
+	text.pagebreak()
+	text.anchor(mobi7TocKey)
+	fmt.Fprintf(&text.buff, `<h2 align="center">%s</h2>`, html.EscapeString(title))
+	for _, ch := range chapters {
+		fmt.Fprintf(&text.buff, `<p width="%dem"><a `, ch.Depth*2)
+		text.link(ch.key, "")
+		fmt.Fprintf(&text.buff, `>%s</a></p>`, html.EscapeString(ch.Title))
+	}
+}
+
+// chapter 写入一个章节, 跳过制作说明后的第一个章节作为正文开始位置
+func (text *mobi7Text) chapter(key string, section model.Section, content string) {
+	text.pagebreak()
+	text.anchor(key)
+	if !section.Tips {
+		text.anchor(mobi7StartKey)
+	}
+	text.convert(key, content)
+}
+
+// convert 把 EPUB 章节 HTML 转换为 MOBI7 支持的标签, scope 用于区分各章节的锚点
+func (text *mobi7Text) convert(scope, content string) {
+	var ends []string
+	z := xhtml.NewTokenizer(strings.NewReader(content))
+	for {
+		tt := z.Next()
+		switch tt {
+		case xhtml.ErrorToken:
+			for i := len(ends) - 1; i >= 0; i-- {
+				text.buff.WriteString(ends[i])
+			}
+			return
+		case xhtml.TextToken:
+			text.buff.Write(z.Raw())
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			token := z.Token()
+			if id := tokenAttr(token, "id"); id != "" {
+				text.anchor(scope + "#" + id)
+			}
+			end := text.tag(scope, token)
+			if tt == xhtml.StartTagToken && !voidTag(token.Data) {
+				ends = append(ends, end)
+			}
+		case xhtml.EndTagToken:
+			if len(ends) > 0 {
+				text.buff.WriteString(ends[len(ends)-1])
+				ends = ends[:len(ends)-1]
+			}
+		}
+	}
+}
+
+// mobi7Tags 原样保留的标签, 只保留表格的合并属性
+var mobi7Tags = map[string]bool{
+	"b": true, "i": true, "u": true, "s": true, "strong": true, "em": true, "sup": true, "sub": true,
+	"small": true, "big": true, "code": true, "pre": true, "blockquote": true, "br": true, "hr": true,
+	"table": true, "tr": true, "td": true, "th": true, "ol": true, "ul": true, "li": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "p": true, "div": true,
+}
+
+// tag 写入开始标签, 返回对应的结束标签
+func (text *mobi7Text) tag(scope string, token xhtml.Token) string {
+	book := text.book
+	classes := strings.Fields(tokenAttr(token, "class"))
+	switch token.Data {
+	case "h2":
+		if contains(classes, "volume") || contains(classes, "colophon-title") || contains(classes, "about-title") {
+			text.buff.WriteString(`<h2 align="center">`)
+			return "</h2>"
+		}
+	case "h3":
+		if contains(classes, "title") {
+			fmt.Fprintf(&text.buff, `<h3 align="%s">`, html.EscapeString(book.Align))
+			return "</h3>"
+		}
+	case "p":
+		if contains(classes, "content") {
+			// width 为首行缩进, height 为段前间距
+			text.buff.WriteString("<p")
+			if strings.HasSuffix(book.Bottom, "em") && strings.Trim(book.Bottom, "0.em") != "" {
+				fmt.Fprintf(&text.buff, ` height="%s"`, html.EscapeString(book.Bottom))
+			}
+			indent := book.Indent
+			if contains(classes, "first") && render.HasDropCap(book) {
+				indent = 0
+			}
+			fmt.Fprintf(&text.buff, ` width="%dem">`, indent)
+			return "</p>"
+		}
+	case "span":
+		// 单独显示的章节序号后换行, 其他 span 只保留文字
+		if contains(classes, "chapter-number") {
+			return "<br/>"
+		}
+		// MOBI7 不支持浮动, 首字下沉显示为放大的首字
+		if contains(classes, "first-letter") && render.HasDropCap(book) {
+			text.buff.WriteString(`<font size="+2">`)
+			return "</font>"
+		}
+		return ""
+	case "div":
+		if contains(classes, "titlepage") {
+			text.buff.WriteString(`<div align="center">`)
+			return "</div>"
+		}
+		if contains(classes, "chapter-header-image") {
+			align := "center"
+			for _, c := range []string{"left", "right"} {
+				if contains(classes, c) {
+					align = c
+				}
+			}
+			fmt.Fprintf(&text.buff, `<div align="%s">`, align)
+			return "</div>"
+		}
+	case "aside", "section", "nav":
+		text.buff.WriteString("<div>")
+		return "</div>"
+	case "a":
+		href := tokenAttr(token, "href")
+		switch {
+		case strings.HasPrefix(href, "#"):
+			text.buff.WriteString("<a ")
+			text.link(scope+href, scope)
+			text.buff.WriteString(">")
+		case strings.HasPrefix(href, "http://"), strings.HasPrefix(href, "https://"):
+			fmt.Fprintf(&text.buff, `<a href="%s">`, html.EscapeString(href))
+		default:
+			text.buff.WriteString("<a>")
+		}
+		return "</a>"
+	case "img":
+		// 读取不到的图片直接去掉
+		if index, ok := text.image(tokenAttr(token, "src")); ok {
+			fmt.Fprintf(&text.buff, `<img recindex="%05d"/>`, index)
+		}
+		return ""
+	}
+	if !mobi7Tags[token.Data] {
+		// ruby 等不支持的标签只保留文字, 注音显示在括号中
+		return ""
+	}
+	text.buff.WriteString("<" + token.Data)
+	for _, name := range []string{"colspan", "rowspan"} {
+		if v := tokenAttr(token, name); v != "" {
+			fmt.Fprintf(&text.buff, ` %s="%s"`, name, html.EscapeString(v))
+		}
+	}
+	if voidTag(token.Data) {
+		text.buff.WriteString("/>")
+		return ""
+	}
+	text.buff.WriteString(">")
+	return "</" + token.Data + ">"
+}
+
+// image 添加图片, 返回从 1 开始的 recindex
+func (text *mobi7Text) image(src string) (int, bool) {
+	if src == "" {
+		return 0, false
+	}
+	if index, ok := text.imageIndex[src]; ok {
+		return index, true
+	}
+	img, err := decodeImage(src)
+	if err != nil {
+		fmt.Println("添加图片失败:", err)
+		return 0, false
+	}
+	text.images = append(text.images, img)
+	text.imageIndex[src] = len(text.images)
+	return len(text.images), true
+}
+
+func tokenAttr(token xhtml.Token, name string) string {
+	for _, attr := range token.Attr {
+		if attr.Key == name {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func voidTag(name string) bool {
+	return name == "br" || name == "hr" || name == "img"
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
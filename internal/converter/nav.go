@@ -0,0 +1,224 @@
+package converter
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/feewg/kaf-cli/internal/model"
+	"github.com/feewg/kaf-cli/internal/render"
+	"github.com/feewg/kaf-cli/internal/utils"
+)
+
+const (
+	navCoverHref = "xhtml/cover.xhtml"
+	tocPageName  = "toc.xhtml"
+	// tocPagePlaceholder 内嵌目录页的占位内容, 生成 EPUB 后替换为目录
+	tocPagePlaceholder = "<!-- kaf-cli:toc -->"
+)
+
+// navPoint 目录项, Href 相对于 EPUB 目录(nav.xhtml 所在目录)
+type navPoint struct {
+	Title    string
+	Href     string
+	Children []*navPoint
+}
+
+// epubNav 生成 EPUB 目录所需的信息
+// go-epub 生成的 toc.ncx 缺少 dtb:uid 和 playOrder, 也没有 landmarks, 生成后统一替换
+type epubNav struct {
+	Points      []*navPoint
+	Cover       bool        // 是否有封面页
+	Front       [][3]string // 书名页、版权页等正文前页面的 landmarks
+	TocPage     bool        // 是否有内嵌目录页
+	TocPageBody string      // 内嵌目录页的内容
+	BodyStart   string      // 正文开始位置
+}
+
+// add 添加目录项, parent 为空时添加到顶层
+func (nav *epubNav) add(parent *navPoint, title, filename string) *navPoint {
+	point := &navPoint{Title: render.PlainTitle(title), Href: "xhtml/" + filename}
+	if parent == nil {
+		nav.Points = append(nav.Points, point)
+	} else {
+		parent.Children = append(parent.Children, point)
+	}
+	return point
+}
+
+// bodyStart 记录第一个正文章节作为正文开始位置, 跳过制作说明
+func (nav *epubNav) bodyStart(section model.Section, filename string) {
+	if nav.BodyStart == "" && !section.Tips {
+		nav.BodyStart = "xhtml/" + filename
+	}
+}
+
+func (nav *epubNav) depth() int {
+	var walk func(points []*navPoint) int
+	walk = func(points []*navPoint) int {
+		var deepest int
+		for _, p := range points {
+			if d := 1 + walk(p.Children); d > deepest {
+				deepest = d
+			}
+		}
+		return deepest
+	}
+	return max(walk(nav.Points), 1)
+}
+
+// navLabels 各语言的目录标题和 landmarks 标题
+var navLabels = map[string]map[string]string{
+	"zh": {"toc": "目录", "cover": "封面", "start": "正文"},
+	"ja": {"toc": "目次", "cover": "表紙", "start": "本文"},
+	"en": {"toc": "Table of Contents", "cover": "Cover", "start": "Start"},
+}
+
+// navLabel 按语言返回导航中的文字, 没有对应语言时使用英文
+func navLabel(lang, key string) string {
+	return utils.LangValue(navLabels, lang, "en")[key]
+}
+
+// writeNavList 按缩进写入嵌套的 ol 列表, prefix 用于内嵌目录页调整相对路径
+func writeNavList(buff *strings.Builder, points []*navPoint, indent, prefix string) {
+	buff.WriteString(indent + "<ol>\n")
+	for _, p := range points {
+		href := strings.TrimPrefix(p.Href, prefix)
+		if len(p.Children) == 0 {
+			fmt.Fprintf(buff, "%s  <li><a href=\"%s\">%s</a></li>\n", indent, href, html.EscapeString(p.Title))
+			continue
+		}
+		fmt.Fprintf(buff, "%s  <li>\n%s    <a href=\"%s\">%s</a>\n", indent, indent, href, html.EscapeString(p.Title))
+		writeNavList(buff, p.Children, indent+"    ", prefix)
+		buff.WriteString(indent + "  </li>\n")
+	}
+	buff.WriteString(indent + "</ol>\n")
+}
+
+// landmarks 返回 EPUB3 landmarks 和 EPUB2 guide 共用的导航点: 类型、标题、链接
+func (nav *epubNav) landmarks(lang string) [][3]string {
+	var ret [][3]string
+	if nav.Cover {
+		ret = append(ret, [3]string{"cover", navLabel(lang, "cover"), navCoverHref})
+	}
+	ret = append(ret, nav.Front...)
+	if nav.TocPage {
+		ret = append(ret, [3]string{"toc", navLabel(lang, "toc"), "xhtml/" + tocPageName})
+	} else {
+		ret = append(ret, [3]string{"toc", navLabel(lang, "toc"), "nav.xhtml#toc"})
+	}
+	if nav.BodyStart != "" {
+		ret = append(ret, [3]string{"bodymatter", navLabel(lang, "start"), nav.BodyStart})
+	}
+	return ret
+}
+
+// navDocument 生成 EPUB3 的 nav.xhtml, 包含嵌套目录和 landmarks
+func (nav *epubNav) navDocument(book model.Book) string {
+	title := navLabel(book.Lang, "toc")
+	var buff strings.Builder
+	buff.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+  <head>
+`)
+	fmt.Fprintf(&buff, "    <title dir=\"auto\">%s</title>\n  </head>\n  <body dir=\"auto\">\n", html.EscapeString(book.Bookname))
+	fmt.Fprintf(&buff, "    <nav epub:type=\"toc\" id=\"toc\">\n      <h1>%s</h1>\n", title)
+	writeNavList(&buff, nav.Points, "      ", "")
+	buff.WriteString("    </nav>\n    <nav epub:type=\"landmarks\" hidden=\"\">\n      <ol>\n")
+	for _, l := range nav.landmarks(book.Lang) {
+		fmt.Fprintf(&buff, "        <li><a epub:type=\"%s\" href=\"%s\">%s</a></li>\n", l[0], l[2], html.EscapeString(l[1]))
+	}
+	buff.WriteString("      </ol>\n    </nav>\n  </body>\n</html>\n")
+	return buff.String()
+}
+
+// ncxDocument 生成 EPUB2 的 toc.ncx, 与 nav.xhtml 的目录结构一致
+func (nav *epubNav) ncxDocument(book model.Book) string {
+	var buff strings.Builder
+	buff.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <head>
+`)
+	fmt.Fprintf(&buff, "    <meta name=\"dtb:uid\" content=\"%s\"/>\n", html.EscapeString(book.UID()))
+	fmt.Fprintf(&buff, "    <meta name=\"dtb:depth\" content=\"%d\"/>\n", nav.depth())
+	buff.WriteString("    <meta name=\"dtb:totalPageCount\" content=\"0\"/>\n    <meta name=\"dtb:maxPageNumber\" content=\"0\"/>\n  </head>\n")
+	fmt.Fprintf(&buff, "  <docTitle>\n    <text>%s</text>\n  </docTitle>\n", html.EscapeString(book.Bookname))
+	fmt.Fprintf(&buff, "  <docAuthor>\n    <text>%s</text>\n  </docAuthor>\n", html.EscapeString(strings.Join(book.Authors(), " & ")))
+	buff.WriteString("  <navMap>\n")
+	var order int
+	var walk func(points []*navPoint, indent string)
+	walk = func(points []*navPoint, indent string) {
+		for _, p := range points {
+			order++
+			fmt.Fprintf(&buff, "%s<navPoint id=\"navPoint-%d\" playOrder=\"%d\">\n", indent, order, order)
+			fmt.Fprintf(&buff, "%s  <navLabel>\n%s    <text>%s</text>\n%s  </navLabel>\n", indent, indent, html.EscapeString(p.Title), indent)
+			fmt.Fprintf(&buff, "%s  <content src=\"%s\"/>\n", indent, p.Href)
+			walk(p.Children, indent+"  ")
+			buff.WriteString(indent + "</navPoint>\n")
+		}
+	}
+	walk(nav.Points, "    ")
+	buff.WriteString("  </navMap>\n</ncx>\n")
+	return buff.String()
+}
+
+// tocPageBody 生成正文前内嵌目录页的内容, 链接相对于 xhtml 目录, 设置了目录页模板时按模板渲染
+func (nav *epubNav) tocPageBody(book model.Book, r *render.Renderer) (string, error) {
+	if render.HasTemplate(book, render.TocPageTemplate) {
+		return r.TocPage(navLabel(book.Lang, "toc"), tocItems(nav.Points, "xhtml/"))
+	}
+	var buff strings.Builder
+	fmt.Fprintf(&buff, "<nav class=\"toc-page\">\n  <h2 class=\"toc-title\">%s</h2>\n", navLabel(book.Lang, "toc"))
+	writeNavList(&buff, nav.Points, "  ", "xhtml/")
+	buff.WriteString("</nav>\n")
+	return buff.String(), nil
+}
+
+// tocItems 把目录项转换为目录页模板的数据, prefix 用于调整相对路径
+func tocItems(points []*navPoint, prefix string) []render.TocItem {
+	var items []render.TocItem
+	for _, p := range points {
+		items = append(items, render.TocItem{
+			Title:    p.Title,
+			Href:     strings.TrimPrefix(p.Href, prefix),
+			Children: tocItems(p.Children, prefix),
+		})
+	}
+	return items
+}
+
+// guide 生成 EPUB2 的 guide, 对应 EPUB3 的 landmarks
+func (nav *epubNav) guide(lang string) string {
+	var buff strings.Builder
+	buff.WriteString("  <guide>\n")
+	for _, l := range nav.landmarks(lang) {
+		typ := l[0]
+		switch typ {
+		case "bodymatter":
+			typ = "text"
+		case "titlepage":
+			typ = "title-page"
+		}
+		fmt.Fprintf(&buff, "    <reference type=\"%s\" title=\"%s\" href=\"%s\"/>\n", typ, html.EscapeString(l[1]), l[2])
+	}
+	buff.WriteString("  </guide>\n")
+	return buff.String()
+}
+
+// patchEpubNav 用 epubNav 替换 go-epub 生成的 nav.xhtml 和 toc.ncx, 写入 guide 和内嵌目录页
+func patchEpubNav(filename string, book model.Book, nav *epubNav) error {
+	return rewriteEpub(filename, func(name string, data []byte) []byte {
+		switch {
+		case strings.HasSuffix(name, "/nav.xhtml"):
+			return []byte(nav.navDocument(book))
+		case strings.HasSuffix(name, "/toc.ncx"):
+			return []byte(nav.ncxDocument(book))
+		case strings.HasSuffix(name, ".opf"):
+			return []byte(strings.Replace(string(data), "</package>", nav.guide(book.Lang)+"</package>", 1))
+		case nav.TocPage && strings.HasSuffix(name, "/xhtml/"+tocPageName):
+			return []byte(strings.Replace(string(data), tocPagePlaceholder, nav.TocPageBody, 1))
+		}
+		return data
+	})
+}
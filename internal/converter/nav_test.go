@@ -0,0 +1,31 @@
+package converter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLandmarks(t *testing.T) {
+	nav := &epubNav{Cover: true, BodyStart: "xhtml/chapter_0.xhtml"}
+	tests := []struct {
+		lang string
+		want []string
+	}{
+		{"zh", []string{"封面", "目录", "正文"}},
+		{"zh-TW", []string{"封面", "目录", "正文"}},
+		{"ja", []string{"表紙", "目次", "本文"}},
+		{"en", []string{"Cover", "Table of Contents", "Start"}},
+		{"de", []string{"Cover", "Table of Contents", "Start"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang, func(t *testing.T) {
+			var got []string
+			for _, landmark := range nav.landmarks(tt.lang) {
+				got = append(got, landmark[1])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("landmarks 标题 = %v, 期望 %v", got, tt.want)
+			}
+		})
+	}
+}
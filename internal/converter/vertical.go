@@ -0,0 +1,18 @@
+package converter
+
+import (
+	"github.com/leotaku/mobi/pdb"
+	"github.com/leotaku/mobi/records"
+	"github.com/leotaku/mobi/types"
+)
+
+// setVerticalEXTH 为 KF8 书籍写入竖排和从右向左翻页的 EXTH 记录
+func setVerticalEXTH(db *pdb.Database) {
+	null, ok := db.Records[0].(records.NullRecord)
+	if !ok {
+		return
+	}
+	null.EXTHSection.AddString(types.EXTHPrimaryWritingMode, "vertical-rl")
+	null.EXTHSection.AddString(types.EXTHPageProgressionDirection, "rtl")
+	db.ReplaceRecord(0, null)
+}
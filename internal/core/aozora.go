@@ -0,0 +1,550 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/feewg/kaf-cli/internal/model"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/transform"
+)
+
+// 青空文库格式: https://www.aozora.gr.jp/annotation/
+var (
+	aozoraNoteReg      = regexp.MustCompile(`※?［＃([^］]*)］`)
+	aozoraSeparatorReg = regexp.MustCompile(`^-{20,}$`)
+	// 见出し: ［＃「第一章」は中見出し］ 或 ［＃中見出し］第一章［＃中見出し終わり］
+	aozoraHeadingReg      = regexp.MustCompile(`［＃「[^」]+」は(?:同行|窓)?([大中小])見出し］`)
+	aozoraRangeHeadingReg = regexp.MustCompile(`［＃(?:同行|窓)?([大中小])見出し］`)
+	aozoraBlockIndentReg  = regexp.MustCompile(`^ここから(?:(\d+)字下げ|改行天付き)(?:、折り返して(\d+)字下げ)?$`)
+	aozoraBlockBottomReg  = regexp.MustCompile(`^ここから地(?:付き|から(\d+)字上げ)$`)
+	aozoraIndentReg       = regexp.MustCompile(`^(\d+)字下げ$`)
+	aozoraBottomReg       = regexp.MustCompile(`^地(?:付き|から(\d+)字上げ)$`)
+	aozoraTargetReg       = regexp.MustCompile(`^「([^」]+)」(?:に|は)(.+)$`)
+	aozoraUnicodeReg      = regexp.MustCompile(`U\+([0-9A-Fa-f]{4,5})`)
+)
+
+// aozoraStyles 青空文库的强调注记对应的标签
+var aozoraStyles = map[string][2]string{
+	"傍点":    {`<em class="sesame">`, `</em>`},
+	"白ゴマ傍点": {`<em class="sesame-open">`, `</em>`},
+	"丸傍点":   {`<em class="dot">`, `</em>`},
+	"白丸傍点":  {`<em class="dot-open">`, `</em>`},
+	"二重丸傍点": {`<em class="double-circle">`, `</em>`},
+	"黒三角傍点": {`<em class="triangle">`, `</em>`},
+	"白三角傍点": {`<em class="triangle-open">`, `</em>`},
+	"傍線":    {`<span class="underline">`, `</span>`},
+	"太字":    {`<strong>`, `</strong>`},
+	"斜体":    {`<i>`, `</i>`},
+	"縦中横":   {`<span class="tcy">`, `</span>`},
+}
+
+const (
+	aozoraContent = iota
+	aozoraHeading
+	aozoraPageBreak
+	aozoraBlockOpen
+	aozoraBlockClose
+)
+
+const aozoraPageBreakHTML = `<div class="page-break" style="page-break-after: always;"></div>`
+
+type aozoraEvent struct {
+	kind  int
+	level int // 见出し级别: 1 大見出し, 2 中見出し, 3 小見出し
+	title string
+	html  string
+	line  int
+}
+
+// isAozoraFile 判断是否为青空文库格式，兼容 UTF-8 和 Shift_JIS 编码
+// 仅有注记符号还不够（Shift_JIS 的「［＃」在 GBK 中也是合法字符），
+// 还要求 Shift_JIS 能完整解码，并且有记号说明的分隔线或底本信息
+func isAozoraFile(filename string) bool {
+	bs, err := os.ReadFile(filename)
+	if err != nil {
+		return false
+	}
+	head := bs[:min(len(bs), 256*1024)]
+	if !bytes.Contains(head, []byte("［＃")) && !bytes.Contains(head, []byte{0x81, 0x6d, 0x81, 0x94}) {
+		return false
+	}
+	bs = bytes.TrimPrefix(bs, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(bs) {
+		decoded, _, err := transform.Bytes(japanese.ShiftJIS.NewDecoder(), bs)
+		if err != nil || bytes.ContainsRune(decoded, utf8.RuneError) {
+			return false
+		}
+		bs = decoded
+	}
+	if !bytes.Contains(bs, []byte("［＃")) {
+		return false
+	}
+	lines := strings.Split(strings.ReplaceAll(string(bs), "\r\n", "\n"), "\n")
+	_, _, bodyStart, bodyEnd := splitAozora(lines)
+	return bodyStart > 0 || bodyEnd < len(lines)
+}
+
+// readAozora 读取青空文库文件，非 UTF-8 编码时按 Shift_JIS 解码
+func readAozora(filename string) ([]string, string, error) {
+	bs, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, "", err
+	}
+	bs = bytes.TrimPrefix(bs, []byte("\xef\xbb\xbf"))
+	encoding := "utf-8"
+	if !utf8.Valid(bs) {
+		encoding = "shift_jis"
+		decoded, n, err := transform.Bytes(japanese.ShiftJIS.NewDecoder(), bs)
+		if err != nil {
+			fmt.Println("部分内容解码失败: ", err.Error())
+			decoded = append(decoded, bs[n:]...)
+		}
+		bs = decoded
+	}
+	text := strings.ReplaceAll(string(bs), "\r\n", "\n")
+	return strings.Split(text, "\n"), encoding, nil
+}
+
+// readAozoraHeader 读取青空文库文件开头的书名和作者
+func readAozoraHeader(filename string) (title, author string) {
+	lines, _, err := readAozora(filename)
+	if err != nil {
+		return "", ""
+	}
+	title, author, _, _ = splitAozora(lines)
+	return title, author
+}
+
+// splitAozora 拆分青空文库文件的头部（书名、作者、记号说明）、正文和底本信息
+// 返回正文在 lines 中的起止位置
+func splitAozora(lines []string) (title, author string, bodyStart, bodyEnd int) {
+	bodyEnd = len(lines)
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), "底本：") {
+			bodyEnd = i
+			break
+		}
+	}
+	var separators []int
+	for i := 0; i < len(lines) && i < 50 && len(separators) < 2; i++ {
+		if aozoraSeparatorReg.MatchString(strings.TrimSpace(lines[i])) {
+			separators = append(separators, i)
+		}
+	}
+	if len(separators) == 0 {
+		return "", "", 0, bodyEnd
+	}
+	var header []string
+	for _, line := range lines[:separators[0]] {
+		if line = strings.TrimSpace(line); line != "" {
+			header = append(header, line)
+		}
+	}
+	if len(header) > 0 {
+		title = header[0]
+	}
+	if len(header) > 1 {
+		author = header[len(header)-1]
+	}
+	bodyStart = separators[len(separators)-1] + 1
+	return title, author, bodyStart, bodyEnd
+}
+
+// aozoraNumber 把注记中的全角数字转换为整数
+func aozoraNumber(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// normalizeAozoraNote 全角数字转为半角，便于匹配
+func normalizeAozoraNote(note string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '０' && r <= '９' {
+			return r - '０' + '0'
+		}
+		return r
+	}, note)
+}
+
+type aozoraParser struct {
+	book   *model.Book
+	events []aozoraEvent
+	open   []string // 跨行的范围注记，如 ［＃傍点］ 到下一段才结束
+}
+
+// closeStyle 结束范围注记，先关闭其后打开的样式再重新打开，保证标签嵌套正确
+func (p *aozoraParser) closeStyle(buff *strings.Builder, name string) {
+	i := slices.Index(p.open, name)
+	if i == -1 {
+		return
+	}
+	for j := len(p.open) - 1; j >= i; j-- {
+		buff.WriteString(aozoraStyles[p.open[j]][1])
+	}
+	for _, style := range p.open[i+1:] {
+		buff.WriteString(aozoraStyles[style][0])
+	}
+	p.open = slices.Delete(p.open, i, i+1)
+}
+
+// indentStyle 缩进方向随排版方向变化
+func (p *aozoraParser) indentStyle(start, end int) string {
+	var styles []string
+	if start > 0 {
+		if p.book.WritingMode == "vertical" {
+			styles = append(styles, fmt.Sprintf("margin-top: %dem;", start))
+		} else {
+			styles = append(styles, fmt.Sprintf("margin-left: %dem;", start))
+		}
+	}
+	if end > 0 {
+		if p.book.WritingMode == "vertical" {
+			styles = append(styles, fmt.Sprintf("margin-bottom: %dem;", end))
+		} else {
+			styles = append(styles, fmt.Sprintf("margin-right: %dem;", end))
+		}
+	}
+	return strings.Join(styles, " ")
+}
+
+// blockNote 处理独占一行的注记：改页和字下げ块
+func (p *aozoraParser) blockNote(note string, lineNo int) bool {
+	note = normalizeAozoraNote(note)
+	switch {
+	case note == "改ページ" || note == "改丁" || note == "改見開き" || note == "改段":
+		p.events = append(p.events, aozoraEvent{kind: aozoraPageBreak, line: lineNo})
+	case aozoraBlockIndentReg.MatchString(note):
+		m := aozoraBlockIndentReg.FindStringSubmatch(note)
+		first, rest := aozoraNumber(m[1]), aozoraNumber(m[2])
+		style := p.indentStyle(max(first, rest), 0)
+		if rest > first {
+			style += fmt.Sprintf(" text-indent: -%dem;", rest-first)
+		}
+		p.events = append(p.events, aozoraEvent{kind: aozoraBlockOpen, html: fmt.Sprintf(`<div class="indent" style="%s">`, style), line: lineNo})
+	case aozoraBlockBottomReg.MatchString(note):
+		m := aozoraBlockBottomReg.FindStringSubmatch(note)
+		style := "text-align: right; " + p.indentStyle(0, aozoraNumber(m[1]))
+		p.events = append(p.events, aozoraEvent{kind: aozoraBlockOpen, html: fmt.Sprintf(`<div class="bottom" style="%s">`, strings.TrimSpace(style)), line: lineNo})
+	case strings.HasPrefix(note, "ここで") && strings.HasSuffix(note, "終わり"):
+		p.events = append(p.events, aozoraEvent{kind: aozoraBlockClose, line: lineNo})
+	case strings.HasPrefix(note, "ここから"):
+		// 其他块级注记（如字詰め）不影响排版，直接忽略
+	default:
+		return false
+	}
+	return true
+}
+
+// plainText 去除注记，注音按 titleRuby 处理，用于标题
+func plainText(line, ruby string) string {
+	line = aozoraNoteReg.ReplaceAllStringFunc(line, func(note string) string {
+		if strings.HasPrefix(note, "※") {
+			return gaiji(note)
+		}
+		return ""
+	})
+	return strings.TrimSpace(convertRuby(line, titleRuby(ruby), true))
+}
+
+// gaiji 外字注记：有 Unicode 编码时还原为对应字符，否则使用〓占位
+func gaiji(note string) string {
+	if m := aozoraUnicodeReg.FindStringSubmatch(note); m != nil {
+		if code, err := strconv.ParseInt(m[1], 16, 32); err == nil {
+			return string(rune(code))
+		}
+	}
+	return "〓"
+}
+
+// findTarget 在 text 末尾查找注记引用的文字，跳过注音读音和已插入的标签
+// text 为已转义的 HTML，字符实体按转义前的字符与 target 比较
+// 返回引用文字在 text 中的起始位置，找不到时返回 -1
+func findTarget(text, target string) int {
+	i := len(text)
+	j := len(target)
+	for j > 0 {
+		if i == 0 {
+			return -1
+		}
+		r, size := utf8.DecodeLastRuneInString(text[:i])
+		switch r {
+		case '》':
+			start := strings.LastIndex(text[:i], "《")
+			if start == -1 {
+				return -1
+			}
+			i = start
+			continue
+		case '>':
+			start := strings.LastIndexByte(text[:i], '<')
+			if start == -1 {
+				return -1
+			}
+			i = start
+			continue
+		case '｜':
+			i -= size
+			continue
+		case ';':
+			if start := strings.LastIndexByte(text[:i], '&'); start != -1 {
+				if entity := html.UnescapeString(text[start:i]); utf8.RuneCountInString(entity) == 1 {
+					r, size = []rune(entity)[0], i-start
+				}
+			}
+		}
+		t, tsize := utf8.DecodeLastRuneInString(target[:j])
+		if r != t {
+			return -1
+		}
+		i -= size
+		j -= tsize
+	}
+	if strings.HasSuffix(text[:i], "｜") {
+		i -= len("｜")
+	}
+	return i
+}
+
+// inline 处理行内注记，返回 HTML 以及段落样式
+// 注记按原文解析，正文在写入时转义；未结束的范围注记在段末关闭，下一段开头重新打开
+func (p *aozoraParser) inline(line string) (string, string) {
+	var style string
+	var buff strings.Builder
+	for _, name := range p.open {
+		buff.WriteString(aozoraStyles[name][0])
+	}
+	for {
+		loc := aozoraNoteReg.FindStringSubmatchIndex(line)
+		if loc == nil {
+			buff.WriteString(html.EscapeString(line))
+			break
+		}
+		buff.WriteString(html.EscapeString(line[:loc[0]]))
+		raw := line[loc[0]:loc[1]]
+		note := normalizeAozoraNote(line[loc[2]:loc[3]])
+		line = line[loc[1]:]
+		if strings.HasPrefix(raw, "※") {
+			buff.WriteString(html.EscapeString(gaiji(raw)))
+			continue
+		}
+		switch {
+		case aozoraIndentReg.MatchString(note):
+			style = p.indentStyle(aozoraNumber(aozoraIndentReg.FindStringSubmatch(note)[1]), 0) + " text-indent: 0;"
+		case aozoraBottomReg.MatchString(note):
+			style = strings.TrimSpace("text-align: right; " + p.indentStyle(0, aozoraNumber(aozoraBottomReg.FindStringSubmatch(note)[1])))
+		case aozoraTargetReg.MatchString(note):
+			m := aozoraTargetReg.FindStringSubmatch(note)
+			tags, ok := aozoraStyles[m[2]]
+			if !ok {
+				break
+			}
+			text := buff.String()
+			if start := findTarget(text, m[1]); start != -1 {
+				buff.Reset()
+				buff.WriteString(text[:start] + tags[0] + text[start:] + tags[1])
+			}
+		default:
+			// 范围注记: ［＃傍点］…［＃傍点終わり］
+			if tags, ok := aozoraStyles[note]; ok {
+				buff.WriteString(tags[0])
+				p.open = append(p.open, note)
+			} else if name := strings.TrimSuffix(note, "終わり"); name != note {
+				p.closeStyle(&buff, name)
+			}
+		}
+	}
+	for i := len(p.open) - 1; i >= 0; i-- {
+		buff.WriteString(aozoraStyles[p.open[i]][1])
+	}
+	return convertRuby(buff.String(), p.book.Ruby, true), strings.TrimSpace(style)
+}
+
+// headingLevel 返回行内见出し注记的级别，没有时返回 0
+func headingLevel(line string) int {
+	m := aozoraHeadingReg.FindStringSubmatch(line)
+	if m == nil {
+		m = aozoraRangeHeadingReg.FindStringSubmatch(line)
+	}
+	if m == nil {
+		return 0
+	}
+	return strings.Index("大中小", m[1])/len("大") + 1
+}
+
+func (p *aozoraParser) parseLine(line string, lineNo int) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	if m := aozoraNoteReg.FindStringSubmatch(line); m != nil && m[0] == line && !strings.HasPrefix(line, "※") {
+		if p.blockNote(m[1], lineNo) {
+			return
+		}
+	}
+	if level := headingLevel(line); level > 0 {
+		if title := plainText(line, p.book.Ruby); title != "" {
+			p.events = append(p.events, aozoraEvent{kind: aozoraHeading, level: level, title: html.EscapeString(title), line: lineNo})
+		}
+		return
+	}
+	content, style := p.inline(line)
+	if plainText(line, p.book.Ruby) == "" {
+		return
+	}
+	if style != "" {
+		content = fmt.Sprintf(`<p class="content" style="%s">%s</p>`, style, content)
+	} else {
+		content = fmt.Sprintf(`<p class="content">%s</p>`, content)
+	}
+	p.events = append(p.events, aozoraEvent{kind: aozoraContent, html: content, line: lineNo})
+}
+
+// sections 根据见出し级别生成章节：出现两级以上时最高级作为卷，次一级作为章，其余作为小标题
+func (p *aozoraParser) sections(footer string) []model.Section {
+	var levels []int
+	for level := 1; level <= 3; level++ {
+		for _, event := range p.events {
+			if event.kind == aozoraHeading && event.level == level {
+				levels = append(levels, level)
+				break
+			}
+		}
+	}
+	volumeLevel, chapterLevel := 0, 0
+	switch len(levels) {
+	case 0:
+	case 1:
+		chapterLevel = levels[0]
+	default:
+		volumeLevel, chapterLevel = levels[0], levels[1]
+	}
+
+	var sectionList []model.Section
+	var volume *model.Section
+	current := &model.Section{Title: p.book.UnknowTitle}
+	if len(levels) == 0 {
+		current.Title = p.book.Bookname
+	}
+	var content strings.Builder
+	var openBlocks int
+	flush := func() {
+		content.WriteString(strings.Repeat("</div>", openBlocks))
+		openBlocks = 0
+		// 见出し前的改页没有意义
+		current.Content = strings.TrimSuffix(content.String(), aozoraPageBreakHTML)
+		content.Reset()
+		if current.Content == "" && current.Title == p.book.UnknowTitle && volume == nil {
+			return
+		}
+		if volume != nil && current != volume {
+			volume.Sections = append(volume.Sections, *current)
+		} else if current != volume {
+			sectionList = append(sectionList, *current)
+		}
+	}
+	closeVolume := func() {
+		if volume != nil {
+			sectionList = append(sectionList, *volume)
+			volume = nil
+		}
+	}
+	for _, event := range p.events {
+		switch event.kind {
+		case aozoraHeading:
+			switch event.level {
+			case volumeLevel:
+				flush()
+				closeVolume()
+				volume = &model.Section{Title: event.title}
+				current = volume
+			case chapterLevel:
+				flush()
+				if current == volume && volume != nil {
+					volume.Content = current.Content
+				}
+				current = &model.Section{Title: event.title}
+			default:
+				content.WriteString(fmt.Sprintf(`<h4 class="subtitle">%s</h4>`, event.title))
+			}
+		case aozoraPageBreak:
+			if content.Len() > 0 {
+				content.WriteString(aozoraPageBreakHTML)
+			}
+		case aozoraBlockOpen:
+			content.WriteString(event.html)
+			openBlocks++
+		case aozoraBlockClose:
+			if openBlocks > 0 {
+				content.WriteString("</div>")
+				openBlocks--
+			}
+		default:
+			content.WriteString(event.html)
+		}
+	}
+	flush()
+	if current == volume && volume != nil {
+		volume.Content = current.Content
+	}
+	closeVolume()
+	if footer != "" {
+		sectionList = append(sectionList, model.Section{Title: "底本", Content: footer})
+	}
+	return sectionList
+}
+
+// parseAozora 解析青空文库格式的文本
+func parseAozora(book *model.Book) error {
+	fmt.Println("正在读取青空文库格式文件...")
+	start := time.Now()
+	lines, encoding, err := readAozora(book.Filename)
+	if err != nil {
+		return fmt.Errorf("读取文件出错: %w", err)
+	}
+	book.DecodeIssues = &model.DecodeReport{Encoding: encoding}
+	_, _, bodyStart, bodyEnd := splitAozora(lines)
+
+	p := aozoraParser{book: book}
+	title := book.UnknowTitle
+	for i := bodyStart; i < bodyEnd; i++ {
+		line, issue, hasIssue := checkDecodeIssue(lines[i], i+1)
+		if level := headingLevel(line); level > 0 {
+			title = plainText(line, book.Ruby)
+		}
+		if hasIssue {
+			book.DecodeIssues.Add(title, issue)
+		}
+		p.parseLine(line, i+1)
+	}
+
+	var footer strings.Builder
+	for i := bodyEnd; i < len(lines); i++ {
+		if line := strings.TrimSpace(lines[i]); line != "" {
+			footer.WriteString(fmt.Sprintf(`<p class="content">%s</p>`, html.EscapeString(line)))
+		}
+	}
+	sectionList := p.sections(footer.String())
+	// 识别脚注
+	if book.FootnoteReg != nil {
+		var noteIndex int
+		extractAozoraFootnotes(book.FootnoteReg, sectionList, &noteIndex)
+	}
+	return finishParse(book, sectionList, start)
+}
+
+// extractAozoraFootnotes 按顺序识别卷和章节内的脚注
+func extractAozoraFootnotes(reg *regexp.Regexp, sectionList []model.Section, next *int) {
+	for i := range sectionList {
+		extractFootnotes(reg, &sectionList[i], next)
+		extractAozoraFootnotes(reg, sectionList[i].Sections, next)
+	}
+}
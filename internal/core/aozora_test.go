@@ -0,0 +1,116 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/feewg/kaf-cli/internal/model"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+const aozoraSample = `吾輩は猫である
+夏目漱石
+
+-------------------------------------------------------
+【テキスト中に現れる記号について】
+
+［＃］：入力者注　主に外字の説明や、傍点の位置の指定
+-------------------------------------------------------
+
+［＃中見出し］一［＃中見出し終わり］
+
+吾輩は猫である。名前はまだ無い。
+
+底本：「夏目漱石全集1」ちくま文庫、筑摩書房
+`
+
+func TestIsAozoraFile(t *testing.T) {
+	encode := func(enc encoding.Encoding, s string) []byte {
+		bs, err := enc.NewEncoder().Bytes([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bs
+	}
+	// GBK 文本中的「乵仈」与 Shift_JIS 的「［＃」字节相同
+	gbk := append(encode(simplifiedchinese.GBK, "第一章 开始\n"), 0x81, 0x6d, 0x81, 0x94)
+	gbk = append(gbk, encode(simplifiedchinese.GBK, "\n正文。\n")...)
+	tests := []struct {
+		name    string
+		content []byte
+		want    bool
+	}{
+		{"UTF-8", []byte(aozoraSample), true},
+		{"Shift_JIS", encode(japanese.ShiftJIS, aozoraSample), true},
+		{"只有底本信息", []byte("本文［＃「本文」に傍点］\n\n底本：「全集」\n"), true},
+		{"GBK", gbk, false},
+		{"没有记号说明和底本", []byte("第一章\n正文［＃注］\n"), false},
+		{"普通文本", []byte("第一章\n正文\n"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "book.txt")
+			if err := os.WriteFile(filename, tt.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if got := isAozoraFile(filename); got != tt.want {
+				t.Errorf("isAozoraFile = %v, 期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAozoraRangeStyle(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []string
+	}{
+		{
+			name:  "单行",
+			lines: []string{"前［＃傍点］強調［＃傍点終わり］後"},
+			want:  []string{`<p class="content">前<em class="sesame">強調</em>後</p>`},
+		},
+		{
+			name:  "跨行",
+			lines: []string{"一行目［＃太字］太字", "二行目", "三行目［＃太字終わり］普通"},
+			want: []string{
+				`<p class="content">一行目<strong>太字</strong></p>`,
+				`<p class="content"><strong>二行目</strong></p>`,
+				`<p class="content"><strong>三行目</strong>普通</p>`,
+			},
+		},
+		{
+			name:  "交错结束",
+			lines: []string{"［＃太字］甲［＃傍線］乙", "丙［＃太字終わり］丁［＃傍線終わり］"},
+			want: []string{
+				`<p class="content"><strong>甲<span class="underline">乙</span></strong></p>`,
+				`<p class="content"><strong><span class="underline">丙</span></strong><span class="underline">丁</span></p>`,
+			},
+		},
+		{
+			name:  "多余的结束注记",
+			lines: []string{"文字［＃傍点終わり］"},
+			want:  []string{`<p class="content">文字</p>`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := aozoraParser{book: &model.Book{Ruby: "true"}}
+			for i, line := range tt.lines {
+				p.parseLine(line, i+1)
+			}
+			var got []string
+			for _, event := range p.events {
+				got = append(got, event.html)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("得到:\n%s\n期望:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
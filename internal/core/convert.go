@@ -5,25 +5,46 @@ import (
 	"fmt"
 	_ "image/jpeg"
 	_ "image/png"
+	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
 
 	"github.com/feewg/kaf-cli/internal/model"
+	"github.com/feewg/kaf-cli/internal/render"
 	"github.com/feewg/kaf-cli/internal/utils"
 )
 
-func Check(book *model.Book, version string) error {
+func Check(book *model.Book, version string) (err error) {
 	book.Version = version
+	// 检查失败时删除已经生成的临时封面
+	defer func() {
+		if err != nil {
+			book.Cleanup()
+		}
+	}()
 	if err := validateInput(book); err != nil {
 		return err
 	}
-	parseBookInfoFromFilename(book)
+	detectInputFormat(book)
+	if err := compileRegex(book); err != nil {
+		return err
+	}
+	if err := render.ParseTemplates(book); err != nil {
+		return err
+	}
+	parseTextHeader(book)
+	if err := parseBookInfoFromFilename(book); err != nil {
+		return err
+	}
 	setDefaultValues(book)
-	if err := handleCover(book); err != nil {
+	if err := book.CheckMetadata(); err != nil {
 		return err
 	}
-	if err := compileRegex(book); err != nil {
+	if err := checkTipsPosition(book); err != nil {
+		return err
+	}
+	if err := handleCover(book); err != nil {
 		return err
 	}
 	return nil
@@ -36,6 +57,26 @@ func validateInput(book *model.Book) error {
 	return nil
 }
 
+// detectInputFormat 自动识别输入格式，青空文库格式从文件头部读取书名和作者
+func detectInputFormat(book *model.Book) {
+	if book.InputFormat == "" || book.InputFormat == "auto" {
+		book.InputFormat = "txt"
+		if isAozoraFile(book.Filename) {
+			book.InputFormat = "aozora"
+		}
+	}
+	if book.InputFormat != "aozora" {
+		return
+	}
+	title, author := readAozoraHeader(book.Filename)
+	if book.Bookname == "" && title != "" {
+		book.Bookname = title
+	}
+	if (book.Author == "" || book.Author == "YSTYLE") && author != "" {
+		book.Author = author
+	}
+}
+
 // cleanFilenamePrefix 清理文件名前缀
 // 处理格式如: soushu2024@filename.txt -> filename.txt
 // 即去除 @ 符号及其前面的内容
@@ -50,28 +91,74 @@ func cleanFilenamePrefix(filename string) string {
 	return filename
 }
 
-func parseBookInfoFromFilename(book *model.Book) {
+// parseBookInfoFromFilename 按文件名规则提取书名、作者和系列, 先匹配用户设置的规则, 最后匹配默认规则
+// 规则使用命名分组 title、author、series、series_index, 没有命名分组时第一、二个分组分别为书名和作者
+func parseBookInfoFromFilename(book *model.Book) error {
 	// 清理文件名前缀（如 soushu2024@ 等格式）
 	cleanedFilename := cleanFilenamePrefix(book.Filename)
+	name := strings.TrimSuffix(filepath.Base(cleanedFilename), filepath.Ext(cleanedFilename))
 
-	reg, _ := regexp.Compile(`《(.*)》.*作者[：:](.*).txt`)
-	if reg.MatchString(cleanedFilename) {
-		group := reg.FindAllStringSubmatch(cleanedFilename, -1)
-		if len(group) == 1 && len(group[0]) >= 3 {
-			if book.Bookname == "" {
-				book.Bookname = group[0][1]
+	patterns := append(append([]string{}, book.FilenamePatterns...), model.DefaultFilenamePattern)
+	for _, pattern := range patterns {
+		reg, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("文件名规则错误: %s\n%s", pattern, err.Error())
+		}
+		group := reg.FindStringSubmatch(name)
+		if group == nil {
+			continue
+		}
+		fields := map[string]string{}
+		for i, key := range reg.SubexpNames() {
+			// 未命名分组按顺序作为书名和作者
+			if key == "" && i <= 2 {
+				key = []string{"", "title", "author"}[i]
 			}
-			if book.Author == "" || book.Author == "YSTYLE" {
-				book.Author = group[0][2]
+			if i == 0 || key == "" {
+				continue
 			}
+			if value := strings.TrimSpace(group[i]); value != "" && fields[key] == "" {
+				fields[key] = value
+			}
+		}
+		if book.Bookname == "" {
+			book.Bookname = fields["title"]
 		}
+		if fields["author"] != "" && (book.Author == "" || book.Author == "YSTYLE") {
+			book.Author = fields["author"]
+		}
+		if book.Series == "" {
+			book.Series = fields["series"]
+		}
+		if book.SeriesIndex == "" {
+			book.SeriesIndex = fields["series_index"]
+		}
+		break
 	}
 	if book.Bookname == "" {
 		book.Bookname = strings.Split(filepath.Base(cleanedFilename), ".")[0]
 	}
+	return nil
 }
 
 func setDefaultValues(book *model.Book) {
+	// Calibre 目录结构: 输出目录/作者/书名/书名
+	if book.OutputLayout == "calibre" {
+		var dir string
+		if book.Out != "" {
+			dir = filepath.Dir(book.Out)
+			// 批量转换时 Out 为输出文件夹
+			if info, err := os.Stat(book.Out); err == nil && info.IsDir() {
+				dir = book.Out
+			}
+		}
+		author := "Unknown"
+		if authors := book.Authors(); len(authors) > 0 {
+			author = authors[0]
+		}
+		title := utils.SafeFilename(book.Bookname)
+		book.Out = filepath.Join(dir, utils.SafeFilename(author), title, title)
+	}
 	if book.Out == "" {
 		book.Out = book.Bookname
 	}
@@ -79,13 +166,42 @@ func setDefaultValues(book *model.Book) {
 }
 
 func handleCover(book *model.Book) error {
+	// 批量转换时文件夹中的通用封面作为模板背景
+	if book.CoverTemplate != nil && book.CoverBackground != "" && book.Cover == book.CoverBackground {
+		book.Cover = "template"
+	}
+	var dir string
+	switch book.Cover {
+	case "none", "":
+	default:
+		var err error
+		if dir, err = book.MakeTempDir(); err != nil {
+			return fmt.Errorf("创建临时目录失败: %w", err)
+		}
+	}
 	switch book.Cover {
 	case "none":
 		book.Cover = ""
-	case "gen", "orly":
-		cover, err := utils.GenCover(book.Bookname, book.Author, book.CoverOrlyColor, book.CoverOrlyIdx)
+	case "gen", "local":
+		cover, err := utils.GenLocalCover(coverOptions(book), dir)
 		if err != nil {
-			return err
+			return fmt.Errorf("生成封面失败: %w", err)
+		}
+		book.Cover = cover
+	case "template":
+		cover, err := genTemplateCover(book, dir)
+		if err != nil {
+			return fmt.Errorf("生成封面失败: %w", err)
+		}
+		book.Cover = cover
+	case "orly":
+		cover, err := utils.GenCover(book.Bookname, book.Author, book.CoverOrlyColor, book.CoverOrlyIdx, dir)
+		if err != nil {
+			// 无法联网时改为本地生成
+			fmt.Println("在线生成封面失败, 改为本地生成: ", err.Error())
+			if cover, err = utils.GenLocalCover(coverOptions(book), dir); err != nil {
+				return fmt.Errorf("生成封面失败: %w", err)
+			}
 		}
 		book.Cover = cover
 	default:
@@ -93,9 +209,61 @@ func handleCover(book *model.Book) error {
 			book.Cover = ""
 		}
 	}
+	return normalizeCover(book, dir)
+}
+
+// normalizeCover 把封面缩放为设备尺寸的 JPG，避免直接嵌入过大或过小的图片
+func normalizeCover(book *model.Book, dir string) error {
+	if book.Cover == "" || book.CoverFit == "none" {
+		return nil
+	}
+	width, height, err := utils.ParseCoverSize(book.CoverSize)
+	if err != nil {
+		return err
+	}
+	if book.CoverQuality < 1 || book.CoverQuality > 100 {
+		return fmt.Errorf("封面质量应为 1-100: %d", book.CoverQuality)
+	}
+	cover, err := utils.NormalizeCover(book.Cover, utils.CoverNormalize{
+		Width:   width,
+		Height:  height,
+		Fit:     book.CoverFit,
+		Quality: book.CoverQuality,
+	}, dir)
+	if err != nil {
+		return fmt.Errorf("处理封面失败: %w", err)
+	}
+	book.Cover = cover
 	return nil
 }
 
+// genTemplateCover 按配置文件中的封面模板生成封面
+func genTemplateCover(book *model.Book, dir string) (string, error) {
+	if book.CoverTemplate == nil {
+		return "", errors.New("未在配置文件中设置封面模板(cover_template)")
+	}
+	width, height, err := utils.ParseCoverSize(book.CoverSize)
+	if err != nil {
+		return "", err
+	}
+	tpl := *book.CoverTemplate
+	tpl.Background = utils.DefaultString(tpl.Background, book.CoverBackground)
+	tpl.Font = utils.DefaultString(tpl.Font, book.Font)
+	return utils.GenTemplateCover(tpl, book.Bookname, book.Author, book.Lang, width, height, book.CoverQuality, dir)
+}
+
+// coverOptions 本地封面沿用 orly 封面的主题色和图案参数
+func coverOptions(book *model.Book) utils.CoverOptions {
+	return utils.CoverOptions{
+		Title:   book.Bookname,
+		Author:  book.Author,
+		Color:   book.CoverOrlyColor,
+		Pattern: book.CoverOrlyIdx,
+		Lang:    book.Lang,
+		Font:    book.Font,
+	}
+}
+
 func compileRegex(book *model.Book) error {
 	if book.Match == "" {
 		book.Match = model.DefaultMatchTips
@@ -116,5 +284,13 @@ func compileRegex(book *model.Book) error {
 		book.ExclusionReg = regexp.MustCompile(book.ExclusionPattern)
 	}
 
+	if book.FootnoteMatch != "" && book.FootnoteMatch != "false" {
+		reg, err := regexp.Compile(book.FootnoteMatch)
+		if err != nil {
+			return fmt.Errorf("生成脚注匹配规则出错: %s\n%s\n", book.FootnoteMatch, err.Error())
+		}
+		book.FootnoteReg = reg
+	}
+
 	return nil
 }
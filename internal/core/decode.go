@@ -0,0 +1,56 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/feewg/kaf-cli/internal/model"
+)
+
+// decodeIssueSnippetLen 报告中展示的出错行最大字数
+const decodeIssueSnippetLen = 40
+
+// checkDecodeIssue 统计一行中的无效 UTF-8 字节和 U+FFFD 替换字符
+// 返回替换掉无效字节后的行内容，以及该行是否存在编码问题
+func checkDecodeIssue(line string, lineNo int) (string, model.DecodeIssue, bool) {
+	issue := model.DecodeIssue{Line: lineNo}
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		if r == utf8.RuneError {
+			if size == 1 {
+				issue.InvalidBytes++
+			} else {
+				issue.Replacements++
+			}
+		}
+		i += size
+	}
+	if issue.InvalidBytes == 0 && issue.Replacements == 0 {
+		return line, issue, false
+	}
+	line = strings.ToValidUTF8(line, string(utf8.RuneError))
+	issue.Text = line
+	if utf8.RuneCountInString(line) > decodeIssueSnippetLen {
+		issue.Text = string([]rune(line)[:decodeIssueSnippetLen]) + "..."
+	}
+	return line, issue, true
+}
+
+// checkDecodeLimit 输出编码错误报告，并在超过上限时返回错误
+func checkDecodeLimit(book *model.Book) error {
+	report := book.DecodeIssues
+	total := report.Total()
+	if total == 0 {
+		return nil
+	}
+	if book.DecodeReport {
+		fmt.Print(report.String())
+	} else {
+		fmt.Printf("检测到 %d 处无法解码的字符, 可使用 -decode-report 查看所在章节和行号\n", total)
+	}
+	if book.MaxDecodeErrors > 0 && total > book.MaxDecodeErrors {
+		return fmt.Errorf("无法解码的字符数 %d 超过上限 %d", total, book.MaxDecodeErrors)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/feewg/kaf-cli/internal/model"
+)
+
+var contentParagraphReg = regexp.MustCompile(`<p class="content">(.*?)</p>`)
+
+// footnoteLabel 返回脚注标记中第一个非空分组作为编号，没有分组时使用整个标记
+func footnoteLabel(reg *regexp.Regexp, marker string) string {
+	groups := reg.FindStringSubmatch(marker)
+	for _, group := range groups[1:] {
+		if group != "" {
+			return group
+		}
+	}
+	return marker
+}
+
+// extractFootnotes 识别章节内的脚注
+// 以脚注标记开头、且前文已经引用过该编号的段落视为脚注内容，从正文中移除；
+// 正文中对应的标记替换为指向脚注的链接。next 为全书脚注序号，保证锚点唯一
+func extractFootnotes(reg *regexp.Regexp, section *model.Section, next *int) {
+	if !reg.MatchString(section.Content) {
+		return
+	}
+	paragraphs := contentParagraphReg.FindAllStringSubmatchIndex(section.Content, -1)
+	referenced := map[string]bool{}
+	notes := map[string]*model.Footnote{}
+	var order []string
+	var body strings.Builder
+	lastEnd := 0
+	for _, loc := range paragraphs {
+		inner := section.Content[loc[2]:loc[3]]
+		if m := reg.FindStringIndex(inner); m != nil && m[0] == 0 {
+			label := footnoteLabel(reg, inner[:m[1]])
+			text := strings.TrimLeft(strings.TrimSpace(inner[m[1]:]), ":：")
+			if referenced[label] && notes[label] == nil && text != "" {
+				*next++
+				notes[label] = &model.Footnote{
+					ID:      fmt.Sprintf("note-%d", *next),
+					Label:   inner[:m[1]],
+					Content: strings.TrimSpace(text),
+				}
+				order = append(order, label)
+				body.WriteString(section.Content[lastEnd:loc[0]])
+				lastEnd = loc[1]
+				continue
+			}
+		}
+		for _, marker := range reg.FindAllString(inner, -1) {
+			referenced[footnoteLabel(reg, marker)] = true
+		}
+	}
+	if len(order) == 0 {
+		return
+	}
+	body.WriteString(section.Content[lastEnd:])
+
+	// 把正文中的标记替换为脚注链接，同一脚注只有第一次引用带有锚点
+	linked := map[string]bool{}
+	section.Content = reg.ReplaceAllStringFunc(body.String(), func(marker string) string {
+		note := notes[footnoteLabel(reg, marker)]
+		if note == nil {
+			return marker
+		}
+		if linked[note.ID] {
+			return fmt.Sprintf(`<sup><a class="noteref" href="#%s">%s</a></sup>`, note.ID, marker)
+		}
+		linked[note.ID] = true
+		return fmt.Sprintf(`<sup><a class="noteref" id="%s" href="#%s">%s</a></sup>`, note.RefID(), note.ID, marker)
+	})
+	for _, label := range order {
+		section.Footnotes = append(section.Footnotes, *notes[label])
+	}
+}
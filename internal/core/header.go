@@ -0,0 +1,171 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/feewg/kaf-cli/internal/model"
+	"golang.org/x/text/transform"
+)
+
+// 书籍信息最多出现在文件开头的行数和字节数, 以及简介最多延续的行数
+const (
+	headerMaxLines            = 60
+	headerMaxBytes            = 64 << 10
+	headerMaxDescriptionLines = 5
+)
+
+// headerKeys 书籍信息的键名
+const headerKeys = `书\s*名|作\s*者|译\s*者|内容简介|简\s*介|内容介绍|文\s*案|标\s*签|类\s*型|分\s*类|系\s*列|出版社|ISBN`
+
+// headerReg 匹配文件开头的书籍信息, 如 书名：xxx、【作者】xxx、内容简介:
+// 键名后必须有冒号, 只有带括号的写法可以省略冒号
+var headerReg = regexp.MustCompile(`^(?:[【\[]\s*(` + headerKeys + `)\s*[】\]]\s*[：:]?|(` + headerKeys + `)\s*[：:])\s*(.*)$`)
+
+// headerKey 统一书籍信息的键名
+func headerKey(key string) string {
+	key = strings.ReplaceAll(key, " ", "")
+	switch key {
+	case "书名":
+		return "title"
+	case "作者":
+		return "author"
+	case "译者":
+		return "translator"
+	case "内容简介", "简介", "内容介绍", "文案":
+		return "description"
+	case "标签", "类型", "分类":
+		return "tags"
+	case "系列":
+		return "series"
+	case "出版社":
+		return "publisher"
+	}
+	return strings.ToLower(key)
+}
+
+// textHeader 文件开头的书籍信息
+type textHeader struct {
+	fields map[string]string
+	lines  int // 书籍信息占用的行数
+}
+
+// openHeader 打开文件开头用于识别书籍信息的部分, 非 UTF-8 编码时边读边解码
+func openHeader(filename string) (*bufio.Reader, io.Closer, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	buf := bufio.NewReader(io.LimitReader(f, headerMaxBytes))
+	bs, _ := buf.Peek(1024)
+	if name, decoder := detectEncoding(bs); name != "utf-8" {
+		buf = bufio.NewReader(transform.NewReader(buf, decoder))
+	}
+	return buf, f, nil
+}
+
+// readTextHeader 识别文件开头的书籍信息块
+// 简介可以跨多行, 但只有在后面出现空行或下一项书籍信息时才算作简介,
+// 遇到章节标题或超过 headerMaxDescriptionLines 行时这些行仍属于正文
+func readTextHeader(book *model.Book) textHeader {
+	header := textHeader{fields: map[string]string{}}
+	buf, closer, err := openHeader(book.Filename)
+	if err != nil {
+		return header
+	}
+	defer closer.Close()
+	var description, pending []string
+	var inDescription bool
+	// 待定的简介行确认属于简介
+	accept := func(lineNo int) {
+		if len(pending) > 0 {
+			description = append(description, pending...)
+			pending = nil
+			header.lines = lineNo
+		}
+	}
+	for lineNo := 1; lineNo <= headerMaxLines; lineNo++ {
+		line, err := buf.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			accept(lineNo - 1)
+			break
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "\ufeff"))
+		if line == "" {
+			accept(lineNo - 1)
+			inDescription = false
+			continue
+		}
+		if group := headerReg.FindStringSubmatch(line); group != nil {
+			accept(lineNo - 1)
+			key, value := headerKey(group[1]+group[2]), strings.TrimSpace(group[3])
+			inDescription = key == "description"
+			if inDescription {
+				if value != "" {
+					description = append(description, value)
+				}
+			} else if value != "" {
+				header.fields[key] = value
+			}
+			header.lines = lineNo
+			continue
+		}
+		if !inDescription || len(pending) == headerMaxDescriptionLines || (book.Reg != nil && book.Reg.MatchString(line)) {
+			break
+		}
+		pending = append(pending, line)
+	}
+	if len(description) > 0 {
+		header.fields["description"] = strings.Join(description, "\n")
+	}
+	if len(header.fields) == 0 {
+		header.lines = 0
+	}
+	return header
+}
+
+// parseTextHeader 从文件开头的书籍信息中读取书名、作者、简介和标签
+// 已在参数或配置中设置的信息不会被覆盖, 解析正文时跳过这些行
+func parseTextHeader(book *model.Book) {
+	if book.InputFormat == "aozora" {
+		return
+	}
+	header := readTextHeader(book)
+	book.HeaderLines = header.lines
+	fields := header.fields
+	if header.lines > 0 {
+		fmt.Printf("识别到文件开头的书籍信息, 正文跳过前 %d 行\n", header.lines)
+		if fields["description"] != "" {
+			fmt.Printf("简介:\n%s\n", fields["description"])
+		}
+	}
+	if book.Bookname == "" {
+		book.Bookname = strings.Trim(fields["title"], "《》")
+	}
+	author := strings.TrimSpace(strings.TrimSuffix(fields["author"], "著"))
+	if author != "" && (book.Author == "" || book.Author == "YSTYLE") {
+		book.Author = author
+	}
+	if book.Translator == "" {
+		book.Translator = fields["translator"]
+	}
+	if book.Description == "" {
+		book.Description = fields["description"]
+	}
+	if book.Tags == "" {
+		book.Tags = strings.Join(strings.Fields(fields["tags"]), ",")
+	}
+	if book.Series == "" {
+		book.Series = fields["series"]
+	}
+	if book.Publisher == "" {
+		book.Publisher = fields["publisher"]
+	}
+	if book.ISBN == "" {
+		book.ISBN = fields["isbn"]
+	}
+}
@@ -0,0 +1,66 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/feewg/kaf-cli/internal/model"
+)
+
+func TestReadTextHeader(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		description string
+		lines       int
+	}{
+		{
+			name:        "简介后有空行",
+			content:     "书名：测试\n简介：第一行\n第二行\n\n第一章 开始\n正文\n",
+			description: "第一行\n第二行",
+			lines:       3,
+		},
+		{
+			name:        "简介后接下一项",
+			content:     "简介：第一行\n第二行\n作者：某人\n第一章 开始\n",
+			description: "第一行\n第二行",
+			lines:       3,
+		},
+		{
+			name:        "简介后直接是章节标题",
+			content:     "书名：测试\n简介：一句话简介\n第一章 开始\n正文\n",
+			description: "一句话简介",
+			lines:       2,
+		},
+		{
+			name:        "简介后直接是正文",
+			content:     "书名：测试\n简介：一句话简介\n正文一\n正文二\n正文三\n正文四\n正文五\n正文六\n\n正文七\n",
+			description: "一句话简介",
+			lines:       2,
+		},
+		{
+			name:        "简介到文件结尾",
+			content:     "简介：第一行\n第二行",
+			description: "第一行\n第二行",
+			lines:       2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "book.txt")
+			if err := os.WriteFile(filename, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			book := &model.Book{Filename: filename, Reg: regexp.MustCompile(`^第.+章`)}
+			header := readTextHeader(book)
+			if got := header.fields["description"]; got != tt.description {
+				t.Errorf("简介 = %q, 期望 %q", got, tt.description)
+			}
+			if header.lines != tt.lines {
+				t.Errorf("占用行数 = %d, 期望 %d", header.lines, tt.lines)
+			}
+		})
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"regexp"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -14,10 +13,20 @@ import (
 	"github.com/feewg/kaf-cli/internal/model"
 	"github.com/feewg/kaf-cli/internal/utils"
 	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
 	"golang.org/x/text/encoding/simplifiedchinese"
 	"golang.org/x/text/transform"
 )
 
+// detectEncoding 根据文件开头的内容判断编码, 无法确定时按 GB18030 解码
+func detectEncoding(bs []byte) (string, *encoding.Decoder) {
+	enc, name, _ := charset.DetermineEncoding(bs, "text/plain")
+	if name == "windows-1252" {
+		return "gb18030", simplifiedchinese.GB18030.NewDecoder()
+	}
+	return name, enc.NewDecoder()
+}
+
 func readBuffer(book *model.Book, filename string) *bufio.Reader {
 	f, err := os.Open(filename)
 	if err != nil {
@@ -26,7 +35,8 @@ func readBuffer(book *model.Book, filename string) *bufio.Reader {
 	}
 	temBuf := bufio.NewReader(f)
 	bs, _ := temBuf.Peek(1024)
-	encodig, encodename, _ := charset.DetermineEncoding(bs, "text/plain")
+	encodename, decoder := detectEncoding(bs)
+	book.DecodeIssues = &model.DecodeReport{Encoding: encodename}
 	if encodename != "utf-8" {
 		f.Seek(0, 0)
 		bs, err := io.ReadAll(f)
@@ -35,12 +45,14 @@ func readBuffer(book *model.Book, filename string) *bufio.Reader {
 			os.Exit(1)
 		}
 		var buf bytes.Buffer
-		book.Decoder = encodig.NewDecoder()
-		if encodename == "windows-1252" {
-			book.Decoder = simplifiedchinese.GB18030.NewDecoder()
+		book.Decoder = decoder
+		decoded, n, err := transform.Bytes(book.Decoder, bs)
+		if err != nil {
+			// 解码中途失败时保留已解码的部分，剩余内容按 UTF-8 处理并计入编码错误报告
+			fmt.Println("部分内容解码失败: ", err.Error())
+			decoded = append(decoded, bs[n:]...)
 		}
-		bs, _, _ = transform.Bytes(book.Decoder, bs)
-		buf.Write(bs)
+		buf.Write(decoded)
 		return bufio.NewReader(&buf)
 	} else {
 		f.Seek(0, 0)
@@ -49,88 +61,44 @@ func readBuffer(book *model.Book, filename string) *bufio.Reader {
 	}
 }
 
-// sanitizeHTMLTags 智能处理 HTML 标签
-// 保留 epub 支持的标签（如 img, br, hr 等），转义其他标签
-func sanitizeHTMLTags(line string) string {
-	// 快速检查：如果没有 < 符号，直接返回
-	if !strings.Contains(line, "<") {
-		return line
-	}
-
-	// 定义允许的标签（EPUB 3.0 支持的常用标签）
-	// 只保留最常用的标签以提升性能
-	allowedTags := []string{
-		"img", "br", "hr", // 单标签（最常用）
-		"p", "span", "div",
-		"b", "i", "u", "s", "strong", "em",
-		"a", "table", "tr", "td", "th",
-	}
-
-	// 构建正则表达式来匹配允许的标签
-	var tagPatterns []string
-	for _, tag := range allowedTags {
-		tagPatterns = append(tagPatterns, fmt.Sprintf(`<%s\b[^>]*>`, tag))
-		tagPatterns = append(tagPatterns, fmt.Sprintf(`</%s>`, tag))
-		tagPatterns = append(tagPatterns, fmt.Sprintf(`<%s\b[^>]*/>`, tag))
-	}
-
-	pattern := strings.Join(tagPatterns, "|")
-	re := regexp.MustCompile(pattern)
-
-	// 找到所有匹配的标签
-	matches := re.FindAllStringIndex(line, -1)
-
-	// 如果没有匹配到任何标签，直接全部转义
-	if len(matches) == 0 {
-		line = strings.ReplaceAll(line, "<", "&lt;")
-		line = strings.ReplaceAll(line, ">", "&gt;")
-		return line
-	}
-
-	// 有匹配的标签，需要保护
-	var result strings.Builder
-	lastEnd := 0
-
-	for _, match := range matches {
-		start, end := match[0], match[1]
-
-		// 转义匹配标签之前的文本
-		segment := line[lastEnd:start]
-		segment = strings.ReplaceAll(segment, "<", "&lt;")
-		segment = strings.ReplaceAll(segment, ">", "&gt;")
-		result.WriteString(segment)
-
-		// 保留标签本身
-		result.WriteString(line[start:end])
-		lastEnd = end
-	}
-
-	// 处理最后一部分
-	segment := line[lastEnd:]
-	segment = strings.ReplaceAll(segment, "<", "&lt;")
-	segment = strings.ReplaceAll(segment, ">", "&gt;")
-	result.WriteString(segment)
-
-	return result.String()
-}
-
 func Parse(book *model.Book) error {
 	if book == nil {
 		return fmt.Errorf("book参数不能为nil")
 	}
+	if book.InputFormat == "aozora" {
+		return parseAozora(book)
+	}
 	var contentList []model.Section
 	fmt.Println("正在读取txt文件...")
 	start := time.Now()
 	buf := readBuffer(book, book.Filename)
 	var title string
 	var content bytes.Buffer
+	var lineNo int
+	implicitRuby := utils.LangBase(book.Lang) == "ja"
+	// 记录编码问题，标题为空时归入未知章节
+	addIssue := func(title string, issue model.DecodeIssue) {
+		book.DecodeIssues.Add(utils.DefaultString(title, book.UnknowTitle), issue)
+	}
 	for {
 		line, err := buf.ReadString('\n')
+		lineNo++
+		// 跳过文件开头已识别为书籍信息的行
+		if lineNo <= book.HeaderLines {
+			line = ""
+			if err == nil {
+				continue
+			}
+		}
 		if err != nil {
 			if err == io.EOF {
 				if line != "" {
 					if line = strings.TrimSpace(line); line != "" {
-						utils.AddPart(&content, line)
+						line, issue, hasIssue := checkDecodeIssue(line, lineNo)
+						if hasIssue {
+							addIssue(title, issue)
+						}
+						utils.AddPart(&content, convertRuby(sanitizeHTMLTags(line), book.Ruby, implicitRuby))
 					}
 				}
 				contentList = append(contentList, model.Section{
@@ -143,6 +111,8 @@ func Parse(book *model.Book) error {
 			return fmt.Errorf("读取文件出错: %w", err)
 		}
 		line = strings.TrimSpace(line)
+		// 统计无法解码的字节和替换字符
+		line, issue, hasIssue := checkDecodeIssue(line, lineNo)
 		// 智能处理 HTML 标签：保留 epub 支持的标签，转义其他标签
 		line = sanitizeHTMLTags(line)
 		// 空行直接跳过
@@ -168,12 +138,18 @@ func Parse(book *model.Book) error {
 						Content: content.String(),
 					})
 				}
-				title = line
+				title = convertRuby(line, titleRuby(book.Ruby), implicitRuby)
 				content.Reset()
+				if hasIssue {
+					addIssue(title, issue)
+				}
 				continue
 			}
 		}
-		utils.AddPart(&content, line)
+		if hasIssue {
+			addIssue(title, issue)
+		}
+		utils.AddPart(&content, convertRuby(line, book.Ruby, implicitRuby))
 	}
 	// 没识别到章节又没识别到 EOF 时，把所有的内容写到最后一章
 	if content.Len() != 0 {
@@ -185,6 +161,13 @@ func Parse(book *model.Book) error {
 			Content: content.String(),
 		})
 	}
+	// 识别脚注
+	if book.FootnoteReg != nil {
+		var noteIndex int
+		for i := range contentList {
+			extractFootnotes(book.FootnoteReg, &contentList[i], &noteIndex)
+		}
+	}
 	var sectionList []model.Section
 	var volumeSection *model.Section
 	for _, section := range contentList {
@@ -214,17 +197,21 @@ func Parse(book *model.Book) error {
 		sectionList = append(sectionList, *volumeSection)
 		volumeSection = nil
 	}
+	return finishParse(book, sectionList, start)
+}
+
+// finishParse 输出解析统计、检查编码错误并添加教程章节
+func finishParse(book *model.Book, sectionList []model.Section, start time.Time) error {
 	end := time.Now().Sub(start)
 	fmt.Println("读取文件耗时:", end)
 	fmt.Println("匹配章节:", model.SectionCount(sectionList))
+	if err := checkDecodeLimit(book); err != nil {
+		return err
+	}
 	// 添加提示
-	if book.Tips {
-		tuorialSection := model.Section{
-			Title:   "制作说明",
-			Content: model.Tutorial,
-		}
-		sectionList = append([]model.Section{tuorialSection}, sectionList...)
-		sectionList = append(sectionList, tuorialSection)
+	sectionList, err := addTips(book, sectionList)
+	if err != nil {
+		return err
 	}
 	book.SectionList = sectionList
 	return nil
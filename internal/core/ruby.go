@@ -0,0 +1,39 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// 显式注音: ｜漢字《かんじ》、|汉字《hàn zì》
+	rubyExplicitReg = regexp.MustCompile(`[｜|]([^｜|《》]+)《([^《》]+)》`)
+	// 省略｜时只识别 汉字+假名 的组合，且只用于日文或青空文库格式，避免把中文书名号误识别为注音
+	rubyImplicitReg = regexp.MustCompile(`([\p{Han}々〆ヶ]+)《([\p{Hiragana}\p{Katakana}ー・]+)》`)
+)
+
+// convertRuby 处理青空文库风格的注音标记
+// mode 为 strip 时只保留正文，为 false 时不处理，其他情况生成 ruby 标签
+// implicit 为 false 时只处理带｜的注音
+func convertRuby(line, mode string, implicit bool) string {
+	if mode == "false" || !strings.Contains(line, "《") {
+		return line
+	}
+	repl := `<ruby><rb>$1</rb><rp>（</rp><rt>$2</rt><rp>）</rp></ruby>`
+	if mode == "strip" {
+		repl = "$1"
+	}
+	line = rubyExplicitReg.ReplaceAllString(line, repl)
+	if !implicit {
+		return line
+	}
+	return rubyImplicitReg.ReplaceAllString(line, repl)
+}
+
+// titleRuby 标题用于目录，注音只保留正文，设置为不处理时保持原样
+func titleRuby(mode string) string {
+	if mode == "false" {
+		return mode
+	}
+	return "strip"
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/feewg/kaf-cli/internal/model"
+)
+
+func TestConvertRuby(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		mode     string
+		implicit bool
+		want     string
+	}{
+		{"显式注音", "｜汉字《hàn zì》", "ruby", false, "<ruby><rb>汉字</rb><rp>（</rp><rt>hàn zì</rt><rp>）</rp></ruby>"},
+		{"省略｜", "漢字《かんじ》", "ruby", true, "<ruby><rb>漢字</rb><rp>（</rp><rt>かんじ</rt><rp>）</rp></ruby>"},
+		{"非日文不识别省略｜", "漢字《かんじ》", "ruby", false, "漢字《かんじ》"},
+		{"去除注音", "｜漢字《かんじ》と仮名《かな》", "strip", true, "漢字と仮名"},
+		{"不处理", "｜漢字《かんじ》", "false", true, "｜漢字《かんじ》"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := convertRuby(tt.line, tt.mode, tt.implicit); got != tt.want {
+				t.Errorf("convertRuby(%q) = %q, 期望 %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseRubyTitle 章节标题中的注音随 -ruby 处理，中文书名号不会被当作注音
+func TestParseRubyTitle(t *testing.T) {
+	tests := []struct {
+		lang  string
+		ruby  string
+		title string
+	}{
+		{"zh", "ruby", "第一章 漢字与书名《はな》"},
+		{"ja", "ruby", "第一章 漢字与书名"},
+		{"ja", "strip", "第一章 漢字与书名"},
+		{"ja", "false", "第一章 ｜漢字《かんじ》与书名《はな》"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang+"_"+tt.ruby, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "book.txt")
+			content := "第一章 ｜漢字《かんじ》与书名《はな》\n正文\n"
+			if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			book, err := model.NewBookSimple(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			book.Lang = tt.lang
+			book.Ruby = tt.ruby
+			if err := Check(book, "test"); err != nil {
+				t.Fatal(err)
+			}
+			if err := Parse(book); err != nil {
+				t.Fatal(err)
+			}
+			if len(book.SectionList) == 0 || book.SectionList[0].Title != tt.title {
+				t.Fatalf("章节标题错误: %+v", book.SectionList)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package core
+
+import (
+	"html"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// allowedTags 正文中保留的标签(EPUB 常用标签)及各自允许的属性, 其他标签按文本转义
+var allowedTags = map[string][]string{
+	"img":    {"src", "alt", "width", "height"},
+	"br":     nil,
+	"hr":     nil,
+	"p":      nil,
+	"span":   nil,
+	"div":    nil,
+	"b":      nil,
+	"i":      nil,
+	"u":      nil,
+	"s":      nil,
+	"strong": nil,
+	"em":     nil,
+	"a":      {"href"},
+	"table":  nil,
+	"tr":     nil,
+	"td":     {"colspan", "rowspan"},
+	"th":     {"colspan", "rowspan"},
+}
+
+// globalAttrs 所有保留标签都允许的属性
+var globalAttrs = []string{"class", "id", "title", "lang", "dir"}
+
+// voidTags 没有结束标签的元素, 输出为 <br/> 的形式
+var voidTags = map[string]bool{"img": true, "br": true, "hr": true}
+
+// textEscaper 只转义 XHTML 中必须转义的字符, 引号保持原样
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// sanitizeHTMLTags 按 HTML 词法解析一行正文, 输出合法的 XHTML 片段
+// 保留白名单中的标签和属性, 补全未闭合的标签, 丢弃多余的结束标签, 其他标签和 & 等字符转义为文本
+func sanitizeHTMLTags(line string) string {
+	// 快速检查：没有标签和实体时直接返回
+	if !strings.ContainsAny(line, "<>&") {
+		return line
+	}
+	var buff strings.Builder
+	var stack []string
+	// consumed 已经处理的字节数, 行尾未闭合的标签(如 "<abc 然后")会被词法解析器丢弃, 按文本输出
+	var consumed int
+	z := xhtml.NewTokenizer(strings.NewReader(line))
+	for {
+		tt := z.Next()
+		if tt == xhtml.ErrorToken {
+			buff.WriteString(textEscaper.Replace(line[consumed:]))
+			break
+		}
+		raw := string(z.Raw())
+		consumed += len(raw)
+		switch tt {
+		case xhtml.TextToken:
+			buff.WriteString(textEscaper.Replace(html.UnescapeString(raw)))
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			token := z.Token()
+			attrs, ok := allowedTags[token.Data]
+			if !ok {
+				buff.WriteString(textEscaper.Replace(raw))
+				continue
+			}
+			writeStartTag(&buff, token, attrs)
+			switch {
+			case voidTags[token.Data]:
+				buff.WriteString("/>")
+			case tt == xhtml.SelfClosingTagToken:
+				buff.WriteString("></" + token.Data + ">")
+			default:
+				buff.WriteString(">")
+				stack = append(stack, token.Data)
+			}
+		case xhtml.EndTagToken:
+			name := z.Token().Data
+			if _, ok := allowedTags[name]; !ok {
+				buff.WriteString(textEscaper.Replace(raw))
+				continue
+			}
+			// 关闭到对应的开始标签为止, 中间未闭合的标签一起关闭; 没有对应的开始标签时丢弃
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i] != name {
+					continue
+				}
+				for j := len(stack) - 1; j >= i; j-- {
+					buff.WriteString("</" + stack[j] + ">")
+				}
+				stack = stack[:i]
+				break
+			}
+		default:
+			// 注释、DOCTYPE 等按文本处理
+			buff.WriteString(textEscaper.Replace(raw))
+		}
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		buff.WriteString("</" + stack[i] + ">")
+	}
+	return buff.String()
+}
+
+// writeStartTag 写入开始标签和白名单中的属性, 不写入结尾的 >
+func writeStartTag(buff *strings.Builder, token xhtml.Token, allowed []string) {
+	buff.WriteString("<" + token.Data)
+	seen := make(map[string]bool)
+	for _, attr := range token.Attr {
+		name := attr.Key
+		if seen[name] || !(contains(allowed, name) || contains(globalAttrs, name)) {
+			continue
+		}
+		if (name == "href" || name == "src") && !safeURL(attr.Val) {
+			continue
+		}
+		seen[name] = true
+		buff.WriteString(" " + name + `="` + html.EscapeString(attr.Val) + `"`)
+	}
+}
+
+// safeURL 不允许 javascript: 等可执行的链接
+func safeURL(url string) bool {
+	url = strings.ToLower(strings.Map(func(r rune) rune {
+		// 浏览器会忽略协议中的空白和控制字符
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, url))
+	for _, scheme := range []string{"javascript:", "vbscript:", "data:text"} {
+		if strings.HasPrefix(url, scheme) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,28 @@
+package core
+
+import "testing"
+
+func TestSanitizeHTMLTags(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"纯文本", "普通的一行", "普通的一行"},
+		{"保留白名单标签", `<b class="x" onclick="f()">粗体</b>`, `<b class="x">粗体</b>`},
+		{"转义其他标签", "<script>alert(1)</script>", "&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{"补全未闭合标签", "<b>粗体", "<b>粗体</b>"},
+		{"丢弃多余的结束标签", "文字</b>", "文字"},
+		{"比较符号", "1 < 2 && 3 > 2", "1 &lt; 2 &amp;&amp; 3 &gt; 2"},
+		{"行尾未结束的标签", "他说 <abc 然后没有了", "他说 &lt;abc 然后没有了"},
+		{"行尾只有尖括号", "结尾<", "结尾&lt;"},
+		{"未结束的白名单标签", `前文<b>粗体</b><img src="a.png`, `前文<b>粗体</b>&lt;img src="a.png`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeHTMLTags(tt.in); got != tt.want {
+				t.Errorf("sanitizeHTMLTags(%q) = %q, 期望 %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
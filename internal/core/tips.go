@@ -0,0 +1,86 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/feewg/kaf-cli/internal/model"
+	"github.com/feewg/kaf-cli/internal/utils"
+)
+
+// addTips 按设置的位置在正文前后添加制作说明
+func addTips(book *model.Book, sectionList []model.Section) ([]model.Section, error) {
+	if !book.Tips {
+		return sectionList, nil
+	}
+	tips, err := tipsSection(book)
+	if err != nil {
+		return nil, err
+	}
+	switch book.TipsPosition {
+	case "start":
+		return append([]model.Section{tips}, sectionList...), nil
+	case "end":
+		return append(sectionList, tips), nil
+	}
+	sectionList = append([]model.Section{tips}, sectionList...)
+	return append(sectionList, tips), nil
+}
+
+// checkTipsPosition 检查制作说明的位置
+func checkTipsPosition(book *model.Book) error {
+	switch book.TipsPosition {
+	case "start", "end", "both", "":
+		return nil
+	}
+	return fmt.Errorf("制作说明位置只能为 start、end 或 both: %s", book.TipsPosition)
+}
+
+// tipsSection 生成制作说明章节, 没有设置自定义文件时按语言使用默认内容
+func tipsSection(book *model.Book) (model.Section, error) {
+	title, content := model.DefaultTutorial(book.Lang)
+	if book.TipsFile != "" {
+		data, err := os.ReadFile(localizedFile(book.TipsFile, book.Lang))
+		if err != nil {
+			return model.Section{}, fmt.Errorf("读取制作说明文件失败: %w", err)
+		}
+		data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+		switch strings.ToLower(filepath.Ext(book.TipsFile)) {
+		case ".html", ".htm", ".xhtml":
+			// HTML 文件为页面片段, 与正文使用相同的标签白名单
+			content = sanitizeHTMLTags(string(data))
+		default:
+			// 文本文件按正文处理, 每行为一个段落
+			var buff bytes.Buffer
+			for _, line := range strings.Split(string(data), "\n") {
+				if line = sanitizeHTMLTags(strings.TrimSpace(line)); line != "" {
+					utils.AddPart(&buff, line)
+				}
+			}
+			content = buff.String()
+		}
+	}
+	if book.TipsTitle != "" {
+		title = book.TipsTitle
+	}
+	return model.Section{Title: title, Content: content, Tips: true}, nil
+}
+
+// localizedFile 返回按语言翻译的文件, 如 tips.zh-TW.txt, 其次为基础语言的 tips.zh.txt
+// 都不存在时返回原文件
+func localizedFile(path, lang string) string {
+	ext := filepath.Ext(path)
+	for _, l := range []string{lang, utils.LangBase(lang)} {
+		if l == "" {
+			continue
+		}
+		localized := strings.TrimSuffix(path, ext) + "." + l + ext
+		if ok, _ := utils.IsExists(localized); ok {
+			return localized
+		}
+	}
+	return path
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/feewg/kaf-cli/internal/model"
+)
+
+func TestTipsSectionHTML(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "tips.html")
+	data := "<p class=\"note\" onclick=\"f()\">说明</p>\n<script>alert(1)</script>\n<div>未闭合"
+	if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tips, err := tipsSection(&model.Book{Lang: "zh", TipsFile: filename})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<p class=\"note\">说明</p>\n&lt;script&gt;alert(1)&lt;/script&gt;\n<div>未闭合</div>"
+	if tips.Content != want {
+		t.Errorf("制作说明内容 = %q, 期望 %q", tips.Content, want)
+	}
+}
+
+func TestCheckTipsPosition(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "book.txt")
+	if err := os.WriteFile(filename, []byte("第一章 开始\n正文\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	book, err := model.NewBookSimple(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	book.TipsPosition = "middle"
+	if err := Check(book, "test"); err == nil || !strings.Contains(err.Error(), "middle") {
+		t.Fatalf("错误的制作说明位置应在检查时报错, 实际为 %v", err)
+	}
+}
@@ -70,7 +70,7 @@ func (s *ConverterService) registerConvertTool(srv *server.MCPServer) {
 		),
 		// 可选参数 - 封面设置
 		mcpgo.WithString("cover",
-			mcpgo.Description("封面图片: 本地路径、orly(在线生成)、none(无封面)"),
+			mcpgo.Description("封面图片: 本地路径、gen(本地生成)、template(按YAML配置的cover_template生成)、orly(在线生成，失败时本地生成)、none(无封面)"),
 		),
 		mcpgo.WithString("cover_orly_color",
 			mcpgo.Description("orly封面主题色: 1-16或hex颜色代码"),
@@ -78,6 +78,15 @@ func (s *ConverterService) registerConvertTool(srv *server.MCPServer) {
 		mcpgo.WithNumber("cover_orly_idx",
 			mcpgo.Description("orly封面动物图案: 0-41"),
 		),
+		mcpgo.WithString("cover_size",
+			mcpgo.Description("封面尺寸，默认1600x2560"),
+		),
+		mcpgo.WithString("cover_fit",
+			mcpgo.Description("封面比例处理: letterbox(补边)、crop(裁剪)、none(不处理)，默认letterbox"),
+		),
+		mcpgo.WithNumber("cover_quality",
+			mcpgo.Description("封面JPG质量: 1-100，默认90"),
+		),
 		// 可选参数 - 字体和样式
 		mcpgo.WithString("font",
 			mcpgo.Description("嵌入字体文件路径"),
@@ -103,6 +112,15 @@ func (s *ConverterService) registerConvertTool(srv *server.MCPServer) {
 		mcpgo.WithBoolean("tips",
 			mcpgo.Description("添加制作教程，默认true"),
 		),
+		mcpgo.WithString("tips_file",
+			mcpgo.Description("自定义制作说明文件（.txt 或 .html），存在 tips.ja.txt 这样带语言的文件时按语言使用"),
+		),
+		mcpgo.WithString("tips_title",
+			mcpgo.Description("制作说明标题，默认按语言显示"),
+		),
+		mcpgo.WithString("tips_position",
+			mcpgo.Description("制作说明位置: start(正文前), end(正文后), both(前后都添加)，默认both"),
+		),
 		mcpgo.WithBoolean("separate_chapter_number",
 			mcpgo.Description("分离章节序号和标题样式，默认false"),
 		),
@@ -135,6 +153,130 @@ func (s *ConverterService) registerConvertTool(srv *server.MCPServer) {
 		mcpgo.WithString("chapter_header_image_mode",
 			mcpgo.Description("图片模式: single(所有章节相同), folder(按章节名匹配)，默认single"),
 		),
+		// 脚注
+		mcpgo.WithString("footnote_match",
+			mcpgo.Description("脚注标记正则，第一个非空分组为脚注编号，默认识别[1]和〔注1〕，设为false禁用"),
+		),
+		// 元数据
+		mcpgo.WithString("book_id",
+			mcpgo.Description("书籍唯一标识，为空时根据书名、作者、语言和系列生成"),
+		),
+		mcpgo.WithString("translator",
+			mcpgo.Description("译者，多人用顿号、&或逗号分隔"),
+		),
+		mcpgo.WithString("editor",
+			mcpgo.Description("编者，多人用顿号、&或逗号分隔"),
+		),
+		mcpgo.WithString("illustrator",
+			mcpgo.Description("插画作者，多人用顿号、&或逗号分隔"),
+		),
+		mcpgo.WithString("series",
+			mcpgo.Description("系列名"),
+		),
+		mcpgo.WithString("series_index",
+			mcpgo.Description("在系列中的序号，如 2 或 2.5"),
+		),
+		mcpgo.WithString("description",
+			mcpgo.Description("内容简介"),
+		),
+		mcpgo.WithString("publisher",
+			mcpgo.Description("出版社"),
+		),
+		mcpgo.WithString("pub_date",
+			mcpgo.Description("出版日期，格式: 2006-01-02、2006-01 或 2006"),
+		),
+		mcpgo.WithString("tags",
+			mcpgo.Description("标签，多个用逗号分隔"),
+		),
+		mcpgo.WithString("isbn",
+			mcpgo.Description("ISBN"),
+		),
+		mcpgo.WithString("identifiers",
+			mcpgo.Description("其他标识符，格式 scheme:value，多个用逗号分隔，如 douban:1007305"),
+		),
+		// Calibre
+		mcpgo.WithBoolean("calibre_metadata",
+			mcpgo.Description("在输出文件旁生成 Calibre 的 OPF 元数据和封面，默认false"),
+		),
+		mcpgo.WithString("output_layout",
+			mcpgo.Description("输出目录结构: flat(直接输出), calibre(按 作者/书名/ 输出)，默认flat"),
+		),
+		// 目录
+		mcpgo.WithBoolean("toc_page",
+			mcpgo.Description("在正文前添加目录页，默认false"),
+		),
+		// 页面模板
+		mcpgo.WithString("chapter_template",
+			mcpgo.Description("章节页面模板文件路径（Go html/template）"),
+		),
+		mcpgo.WithString("volume_template",
+			mcpgo.Description("卷页面模板文件路径（Go html/template）"),
+		),
+		mcpgo.WithString("title_page_template",
+			mcpgo.Description("书名页模板文件路径（Go html/template），设置后在正文前添加书名页"),
+		),
+		mcpgo.WithString("colophon_page_template",
+			mcpgo.Description("版权页模板文件路径（Go html/template），设置后添加版权页"),
+		),
+		mcpgo.WithString("about_page_template",
+			mcpgo.Description("内容简介页模板文件路径（Go html/template），设置后添加内容简介页"),
+		),
+		mcpgo.WithString("toc_page_template",
+			mcpgo.Description("目录页模板文件路径（Go html/template），开启toc_page时使用"),
+		),
+		// 正文前的页面
+		mcpgo.WithBoolean("title_page",
+			mcpgo.Description("在正文前添加书名页（书名、作者、系列），默认false"),
+		),
+		mcpgo.WithBoolean("colophon_page",
+			mcpgo.Description("在正文前添加版权页（来源、转换日期、软件版本），默认false"),
+		),
+		mcpgo.WithBoolean("about_page",
+			mcpgo.Description("在正文前添加内容简介页，没有内容简介时不添加，默认false"),
+		),
+		mcpgo.WithString("source",
+			mcpgo.Description("来源，显示在版权页中，如网址或底本"),
+		),
+		// 校验
+		mcpgo.WithBoolean("validate",
+			mcpgo.Description("生成 EPUB 后检查是否符合规范（mimetype、manifest/spine、XHTML 格式、链接），默认false"),
+		),
+		// 分册
+		mcpgo.WithNumber("split_chapters",
+			mcpgo.Description("每册最多章节数，超出时拆分为多册，优先在卷之间拆分，默认0不拆分"),
+		),
+		mcpgo.WithNumber("split_chars",
+			mcpgo.Description("每册最多字数，默认0不限制"),
+		),
+		mcpgo.WithNumber("split_text_size",
+			mcpgo.Description("每册正文最大MB数，按未压缩的正文估算，不是输出文件大小，默认0不限制"),
+		),
+		// 书籍信息识别
+		mcpgo.WithString("filename_pattern",
+			mcpgo.Description("从文件名提取书籍信息的正则，命名分组: title, author, series, series_index"),
+		),
+		// 输入格式
+		mcpgo.WithString("input_format",
+			mcpgo.Description("输入格式: auto(自动识别), txt(普通文本), aozora(青空文库注记格式)，默认auto"),
+		),
+		// 版式
+		mcpgo.WithString("writing_mode",
+			mcpgo.Description("排版方向: horizontal(横排), vertical(竖排，从右向左翻页)，默认horizontal"),
+		),
+		mcpgo.WithString("first_paragraph",
+			mcpgo.Description("章节首段样式: none(不处理), dropcap(首字下沉), firstline(首行加粗), both(首字下沉和首行加粗)，默认none"),
+		),
+		// 注音
+		mcpgo.WithString("ruby",
+			mcpgo.Description("注音标记(｜漢字《かんじ》)处理方式: ruby(生成注音), strip(去除注音), false(不处理)，默认ruby"),
+		),
+		// 编码错误报告
+		mcpgo.WithBoolean("decode_report",
+			mcpgo.Description("输出无法解码字符所在的章节和行号，默认false"),
+		),
+		mcpgo.WithNumber("max_decode_errors",
+			mcpgo.Description("无法解码字符数上限，超过时转换失败，0表示不限制"),
+		),
 		// YAML 配置支持
 		mcpgo.WithString("config_path",
 			mcpgo.Description("YAML 配置文件路径，自动识别时可不指定"),
@@ -194,6 +336,57 @@ func (s *ConverterService) registerBatchConvertTool(srv *server.MCPServer) {
 		mcpgo.WithString("css_variables",
 			mcpgo.Description("全局CSS变量定义"),
 		),
+		mcpgo.WithBoolean("calibre_metadata",
+			mcpgo.Description("为每本书生成 Calibre 的 OPF 元数据和封面"),
+		),
+		mcpgo.WithString("output_layout",
+			mcpgo.Description("输出目录结构: flat(直接输出), calibre(按 作者/书名/ 输出)"),
+		),
+		mcpgo.WithBoolean("toc_page",
+			mcpgo.Description("在正文前添加目录页"),
+		),
+		mcpgo.WithString("chapter_template",
+			mcpgo.Description("章节页面模板文件路径"),
+		),
+		mcpgo.WithString("volume_template",
+			mcpgo.Description("卷页面模板文件路径"),
+		),
+		mcpgo.WithString("title_page_template",
+			mcpgo.Description("书名页模板文件路径"),
+		),
+		mcpgo.WithString("colophon_page_template",
+			mcpgo.Description("版权页模板文件路径"),
+		),
+		mcpgo.WithString("about_page_template",
+			mcpgo.Description("内容简介页模板文件路径"),
+		),
+		mcpgo.WithString("toc_page_template",
+			mcpgo.Description("目录页模板文件路径"),
+		),
+		mcpgo.WithString("first_paragraph",
+			mcpgo.Description("章节首段样式: none, dropcap, firstline, both"),
+		),
+		mcpgo.WithBoolean("title_page",
+			mcpgo.Description("在正文前添加书名页"),
+		),
+		mcpgo.WithBoolean("colophon_page",
+			mcpgo.Description("在正文前添加版权页"),
+		),
+		mcpgo.WithBoolean("about_page",
+			mcpgo.Description("在正文前添加内容简介页"),
+		),
+		mcpgo.WithBoolean("validate",
+			mcpgo.Description("生成 EPUB 后检查是否符合规范"),
+		),
+		mcpgo.WithNumber("split_chapters",
+			mcpgo.Description("每册最多章节数，超出时拆分为多册"),
+		),
+		mcpgo.WithNumber("split_chars",
+			mcpgo.Description("每册最多字数"),
+		),
+		mcpgo.WithNumber("split_text_size",
+			mcpgo.Description("每册正文最大MB数，按未压缩的正文估算"),
+		),
 		// YAML 配置支持
 		mcpgo.WithString("config_path",
 			mcpgo.Description("全局 YAML 配置文件路径"),
@@ -278,6 +471,7 @@ func (s *ConverterService) handleConvert(ctx context.Context, req mcpgo.CallTool
 	}
 
 	if err := core.Parse(book); err != nil {
+		book.Cleanup()
 		logger.Error("parse failed", "error", err)
 		return nil, fmt.Errorf("parsing failed: %w", err)
 	}
@@ -310,6 +504,11 @@ func (s *ConverterService) handleConvert(ctx context.Context, req mcpgo.CallTool
 		strings.Join(outputFiles, "\n"),
 	)
 
+	// 附带编码错误报告，便于修正源文件
+	if book.DecodeIssues.Total() > 0 {
+		resultText += "\n" + book.DecodeIssues.String()
+	}
+
 	return mcpgo.NewToolResultText(resultText), nil
 }
 
@@ -451,11 +650,12 @@ func (s *ConverterService) handleBatchConvert(ctx context.Context, req mcpgo.Cal
 
 // BookInfo 包含书籍信息和相关文件路径
 type BookInfo struct {
-	Book         *model.Book
-	CoverPath    string
-	HeaderPath   string
-	HeaderFolder string
-	Config       *config.Config // 该书籍使用的配置
+	Book            *model.Book
+	CoverPath       string
+	CoverBackground string // 文件夹通用封面，配置了封面模板时作为模板背景
+	HeaderPath      string
+	HeaderFolder    string
+	Config          *config.Config // 该书籍使用的配置
 }
 
 // scanBooks 扫描文件夹获取所有书籍
@@ -630,10 +830,11 @@ func (s *ConverterService) scanSubFolder(subFolder, outputFolder string, parentG
 		}
 
 		info := BookInfo{
-			Book:         book,
-			CoverPath:    localResources["cover"],
-			HeaderPath:   localResources["header"],
-			HeaderFolder: headerFolder,
+			Book:            book,
+			CoverPath:       localResources["cover"],
+			CoverBackground: localResources["cover"],
+			HeaderPath:      localResources["header"],
+			HeaderFolder:    headerFolder,
 		}
 
 		// 优先使用子文件夹配置，其次继承父文件夹配置
@@ -701,6 +902,10 @@ func (s *ConverterService) findResourcesForBook(info BookInfo, folder, bookName
 	if info.CoverPath == "" {
 		info.CoverPath = globalResources["cover"]
 	}
+	// 使用的是文件夹通用封面时，可作为封面模板的背景
+	if info.CoverPath != "" && info.CoverPath == globalResources["cover"] {
+		info.CoverBackground = info.CoverPath
+	}
 	if info.HeaderPath == "" {
 		info.HeaderPath = globalResources["header"]
 	}
@@ -770,6 +975,7 @@ func (s *ConverterService) applyBookResources(book *model.Book, info BookInfo) {
 	if info.CoverPath != "" {
 		book.Cover = info.CoverPath
 	}
+	book.CoverBackground = info.CoverBackground
 	if info.HeaderPath != "" {
 		book.ChapterHeaderImage = info.HeaderPath
 	}
@@ -786,6 +992,7 @@ func (s *ConverterService) convertBook(book *model.Book) error {
 	}
 
 	if err := core.Parse(book); err != nil {
+		book.Cleanup()
 		return fmt.Errorf("parsing failed: %w", err)
 	}
 
@@ -837,6 +1044,15 @@ func (s *ConverterService) applyBookParameters(book *model.Book, args map[string
 	if v, ok := args["cover_orly_idx"].(float64); ok {
 		book.CoverOrlyIdx = int(v)
 	}
+	if v, ok := args["cover_size"].(string); ok && v != "" {
+		book.CoverSize = v
+	}
+	if v, ok := args["cover_fit"].(string); ok && v != "" {
+		book.CoverFit = v
+	}
+	if v, ok := args["cover_quality"].(float64); ok && v > 0 {
+		book.CoverQuality = int(v)
+	}
 
 	// 字体和样式
 	if v, ok := args["font"].(string); ok && v != "" {
@@ -863,6 +1079,15 @@ func (s *ConverterService) applyBookParameters(book *model.Book, args map[string
 	if v, ok := args["tips"].(bool); ok {
 		book.Tips = v
 	}
+	if v, ok := args["tips_file"].(string); ok && v != "" {
+		book.TipsFile = v
+	}
+	if v, ok := args["tips_title"].(string); ok && v != "" {
+		book.TipsTitle = v
+	}
+	if v, ok := args["tips_position"].(string); ok && v != "" {
+		book.TipsPosition = v
+	}
 	if v, ok := args["separate_chapter_number"].(bool); ok {
 		book.SeparateChapterNumber = v
 	}
@@ -897,6 +1122,143 @@ func (s *ConverterService) applyBookParameters(book *model.Book, args map[string
 	if v, ok := args["chapter_header_image_mode"].(string); ok && v != "" {
 		book.ChapterHeaderImageMode = v
 	}
+
+	// 脚注
+	if v, ok := args["footnote_match"].(string); ok && v != "" {
+		book.FootnoteMatch = v
+	}
+
+	// 元数据
+	if v, ok := args["book_id"].(string); ok && v != "" {
+		book.BookID = v
+	}
+	if v, ok := args["translator"].(string); ok && v != "" {
+		book.Translator = v
+	}
+	if v, ok := args["editor"].(string); ok && v != "" {
+		book.Editor = v
+	}
+	if v, ok := args["illustrator"].(string); ok && v != "" {
+		book.Illustrator = v
+	}
+	if v, ok := args["series"].(string); ok && v != "" {
+		book.Series = v
+	}
+	if v, ok := args["series_index"].(string); ok && v != "" {
+		book.SeriesIndex = v
+	}
+	if v, ok := args["description"].(string); ok && v != "" {
+		book.Description = v
+	}
+	if v, ok := args["publisher"].(string); ok && v != "" {
+		book.Publisher = v
+	}
+	if v, ok := args["pub_date"].(string); ok && v != "" {
+		book.PubDate = v
+	}
+	if v, ok := args["tags"].(string); ok && v != "" {
+		book.Tags = v
+	}
+	if v, ok := args["isbn"].(string); ok && v != "" {
+		book.ISBN = v
+	}
+	if v, ok := args["identifiers"].(string); ok && v != "" {
+		book.Identifiers = v
+	}
+
+	// Calibre
+	if v, ok := args["calibre_metadata"].(bool); ok {
+		book.CalibreMetadata = v
+	}
+	if v, ok := args["output_layout"].(string); ok && v != "" {
+		book.OutputLayout = v
+	}
+
+	// 目录
+	if v, ok := args["toc_page"].(bool); ok {
+		book.TocPage = v
+	}
+
+	// 页面模板
+	if v, ok := args["chapter_template"].(string); ok && v != "" {
+		book.ChapterTemplate = v
+	}
+	if v, ok := args["volume_template"].(string); ok && v != "" {
+		book.VolumeTemplate = v
+	}
+	if v, ok := args["title_page_template"].(string); ok && v != "" {
+		book.TitlePageTemplate = v
+	}
+	if v, ok := args["colophon_page_template"].(string); ok && v != "" {
+		book.ColophonPageTemplate = v
+	}
+	if v, ok := args["about_page_template"].(string); ok && v != "" {
+		book.AboutPageTemplate = v
+	}
+	if v, ok := args["toc_page_template"].(string); ok && v != "" {
+		book.TocPageTemplate = v
+	}
+
+	// 正文前的页面
+	if v, ok := args["title_page"].(bool); ok {
+		book.TitlePage = v
+	}
+	if v, ok := args["colophon_page"].(bool); ok {
+		book.ColophonPage = v
+	}
+	if v, ok := args["about_page"].(bool); ok {
+		book.AboutPage = v
+	}
+	if v, ok := args["source"].(string); ok && v != "" {
+		book.Source = v
+	}
+
+	// 校验
+	if v, ok := args["validate"].(bool); ok {
+		book.Validate = v
+	}
+
+	// 分册
+	if v, ok := args["split_chapters"].(float64); ok {
+		book.SplitChapters = int(v)
+	}
+	if v, ok := args["split_chars"].(float64); ok {
+		book.SplitChars = int(v)
+	}
+	if v, ok := args["split_text_size"].(float64); ok {
+		book.SplitTextSize = int(v)
+	}
+
+	// 书籍信息识别
+	if v, ok := args["filename_pattern"].(string); ok && v != "" {
+		book.FilenamePatterns = append(book.FilenamePatterns, v)
+	}
+
+	// 输入格式
+	if v, ok := args["input_format"].(string); ok && v != "" {
+		book.InputFormat = v
+	}
+
+	// 版式
+	if v, ok := args["writing_mode"].(string); ok && v != "" {
+		book.WritingMode = v
+	}
+	if v, ok := args["first_paragraph"].(string); ok && v != "" {
+		book.FirstParagraph = v
+	}
+
+	// 注音
+	if v, ok := args["ruby"].(string); ok && v != "" {
+		book.Ruby = v
+	}
+
+	// 编码错误报告
+	if v, ok := args["decode_report"].(bool); ok {
+		book.DecodeReport = v
+	}
+	if v, ok := args["max_decode_errors"].(float64); ok {
+		book.MaxDecodeErrors = int(v)
+	}
 }
 
 // extractGlobalParams 提取全局样式参数
@@ -907,6 +1269,11 @@ func (s *ConverterService) extractGlobalParams(args map[string]interface{}) map[
 		"format", "font", "align", "indent", "bottom",
 		"line_height", "lang", "separate_chapter_number",
 		"custom_css_file", "extended_css", "css_variables",
+		"calibre_metadata", "output_layout",
+		"toc_page", "validate", "split_chapters", "split_chars", "split_text_size",
+		"chapter_template", "volume_template", "title_page_template", "toc_page_template",
+		"colophon_page_template", "about_page_template", "title_page", "colophon_page", "about_page",
+		"first_paragraph",
 	}
 
 	for _, key := range globalKeys {
@@ -953,6 +1320,57 @@ func (s *ConverterService) applyGlobalParams(book *model.Book, params map[string
 	if v, ok := params["css_variables"].(string); ok && v != "" {
 		book.CSSVariables = v
 	}
+	if v, ok := params["calibre_metadata"].(bool); ok {
+		book.CalibreMetadata = v
+	}
+	if v, ok := params["output_layout"].(string); ok && v != "" {
+		book.OutputLayout = v
+	}
+	if v, ok := params["toc_page"].(bool); ok {
+		book.TocPage = v
+	}
+	if v, ok := params["chapter_template"].(string); ok && v != "" {
+		book.ChapterTemplate = v
+	}
+	if v, ok := params["volume_template"].(string); ok && v != "" {
+		book.VolumeTemplate = v
+	}
+	if v, ok := params["title_page_template"].(string); ok && v != "" {
+		book.TitlePageTemplate = v
+	}
+	if v, ok := params["colophon_page_template"].(string); ok && v != "" {
+		book.ColophonPageTemplate = v
+	}
+	if v, ok := params["about_page_template"].(string); ok && v != "" {
+		book.AboutPageTemplate = v
+	}
+	if v, ok := params["toc_page_template"].(string); ok && v != "" {
+		book.TocPageTemplate = v
+	}
+	if v, ok := params["first_paragraph"].(string); ok && v != "" {
+		book.FirstParagraph = v
+	}
+	if v, ok := params["title_page"].(bool); ok {
+		book.TitlePage = v
+	}
+	if v, ok := params["colophon_page"].(bool); ok {
+		book.ColophonPage = v
+	}
+	if v, ok := params["about_page"].(bool); ok {
+		book.AboutPage = v
+	}
+	if v, ok := params["validate"].(bool); ok {
+		book.Validate = v
+	}
+	if v, ok := params["split_chapters"].(float64); ok {
+		book.SplitChapters = int(v)
+	}
+	if v, ok := params["split_chars"].(float64); ok {
+		book.SplitChars = int(v)
+	}
+	if v, ok := params["split_text_size"].(float64); ok {
+		book.SplitTextSize = int(v)
+	}
 }
 
 // getOutputFiles 获取输出文件列表
@@ -965,11 +1383,14 @@ func (s *ConverterService) getOutputFiles(book *model.Book) []string {
 		formats = []string{book.Format}
 	}
 
-	for _, format := range formats {
-		fpath := book.Out + "." + format
-		if info, err := os.Stat(fpath); err == nil {
-			absPath, _ := filepath.Abs(fpath)
-			outputFiles = append(outputFiles, fmt.Sprintf("- [%s](%s) (%d bytes)", filepath.Base(fpath), absPath, info.Size()))
+	// 分册时每册单独输出
+	for _, part := range book.Parts(book.SplitLimit()) {
+		for _, format := range formats {
+			fpath := part.Out + "." + format
+			if info, err := os.Stat(fpath); err == nil {
+				absPath, _ := filepath.Abs(fpath)
+				outputFiles = append(outputFiles, fmt.Sprintf("- [%s](%s) (%d bytes)", filepath.Base(fpath), absPath, info.Size()))
+			}
 		}
 	}
 
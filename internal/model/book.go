@@ -3,7 +3,10 @@
 import (
 	"errors"
 	"fmt"
+	"html/template"
+	"os"
 	"regexp"
+	"strings"
 
 	"github.com/feewg/kaf-cli/internal/utils"
 	"golang.org/x/text/encoding"
@@ -18,11 +21,33 @@ const (
 	VolumeMatch      = "^第[0-9一二三四五六七八九十零〇百千两 ]+[卷部]"
 	DefaultMatchTips = "^第[0-9一二三四五六七八九十零〇百千两 ]+[章回节集幕卷部]|^[Ss]ection.{1,20}$|^[Cc]hapter.{1,20}$|^[Pp]age.{1,20}$|^\\d{1,4}$|^\\d+、$|^引子$|^楔子$|^章节目录|^章节|^序章|^最终章 \\w{1,20}$|^番外\\d?\\w{0,20}|^完本感言.{0,4}$"
 	DefaultExclusion = "^第[0-9一二三四五六七八九十零〇百千两 ]+(部门|部队|部属|部分|部件|部落|部.*：$)"
+	// DefaultFilenamePattern 默认的文件名规则: 《书名》...作者：作者名
+	DefaultFilenamePattern = "《(?P<title>.*)》.*作者[：:](?P<author>.*)"
+	// DefaultFootnoteMatch 脚注标记, 第一个非空分组为脚注编号
+	DefaultFootnoteMatch = "\\[(\\d{1,3})\\]|〔注(\\d{1,3})〕|【注(\\d{1,3})】"
 	Tutorial         = `本书由kaf-cli生成: <br/>
 制作教程: <a href='https://ystyle.top/2019/12/31/txt-converto-epub-and-mobi/'>https://ystyle.top/2019/12/31/txt-converto-epub-and-mobi</a>
 `
 )
 
+// tutorials 各语言默认的制作说明标题和内容
+var tutorials = map[string][2]string{
+	"zh": {"制作说明", Tutorial},
+	"ja": {"制作について", `本書はkaf-cliで作成されました: <br/>
+作成方法: <a href='https://ystyle.top/2019/12/31/txt-converto-epub-and-mobi/'>https://ystyle.top/2019/12/31/txt-converto-epub-and-mobi</a>
+`},
+	"en": {"About This Edition", `This book was generated by kaf-cli: <br/>
+Tutorial: <a href='https://ystyle.top/2019/12/31/txt-converto-epub-and-mobi/'>https://ystyle.top/2019/12/31/txt-converto-epub-and-mobi</a>
+`},
+}
+
+// DefaultTutorial 按语言返回默认的制作说明标题和内容, zh-TW 等地区语言按基础语言匹配
+// 没有对应语言时使用中文
+func DefaultTutorial(lang string) (title, content string) {
+	t := utils.LangValue(tutorials, lang, "zh")
+	return t[0], t[1]
+}
+
 func NewBookSimple(filename string) (*Book, error) {
 	book := Book{
 		Filename: filename,
@@ -46,10 +71,16 @@ type Book struct {
 	Cover                  string    // 封面图片
 	CoverOrlyColor         string    // 生成封面图片的颜色
 	CoverOrlyIdx           int       // 生成封面图片的动物
+	CoverSize              string    // 封面尺寸, 如 1600x2560
+	CoverFit               string    // 封面比例处理: letterbox(补边), crop(裁剪), none(不处理封面)
+	CoverQuality           int       // 封面 JPG 质量
 	Font                   string    // 嵌入字体
 	Bottom                 string    // 段阿落间距
 	LineHeight             string    // 行高
 	Tips                   bool      // 是否添加教程文本
+	TipsFile               string    // 自定义制作说明文件(.txt 或 .html), 为空时使用默认内容
+	TipsTitle              string    // 制作说明标题, 为空时按语言使用默认标题
+	TipsPosition           string    // 制作说明位置: start(正文前), end(正文后), both(前后都添加)
 	Lang                   string    // 设置语言
 	Out                    string    // 输出文件名
 	Format                 string    // 书籍格式
@@ -67,7 +98,81 @@ type Book struct {
 	ChapterHeaderImageWidth    string // 图片宽度 (default: 100%)
 	ChapterHeaderImageMode     string // 图片模式: single(所有章节相同), folder(从文件夹按章节名匹配)
 	ChapterHeaderImageFolder   string // 图片文件夹路径（当Mode为folder时使用）
-	
+
+	// 封面模板
+	CoverTemplate   *utils.CoverTemplate // 封面模板, 封面设置为 template 时使用
+	CoverBackground string               // 批量转换时文件夹中的通用封面, 配置了封面模板时作为模板背景
+
+	// 元数据
+	BookID      string // 书籍唯一标识, 为空时根据书名、作者、语言和系列生成固定的标识
+	Translator  string // 译者, 多个用顿号、&或逗号分隔, 作者中也可以用 xxx 译 的写法
+	Editor      string // 编者
+	Illustrator string // 插画作者
+	Series      string // 系列名
+	SeriesIndex string // 在系列中的序号, 可以为小数, 如 1.5
+	Description string // 内容简介
+	Publisher   string // 出版社
+	PubDate     string // 出版日期: 2006-01-02、2006-01 或 2006
+	Tags        string // 标签, 多个用逗号分隔
+	ISBN        string // ISBN
+	Identifiers string // 其他标识符, 格式 scheme:value, 多个用逗号分隔, 如 douban:1007305
+
+	// Calibre
+	CalibreMetadata bool   // 在输出文件旁生成 Calibre 的 OPF 元数据和封面
+	OutputLayout    string // 输出目录结构: flat(直接输出), calibre(作者/书名/)
+
+	// 目录
+	TocPage bool // 在正文前添加目录页
+
+	// 校验
+	Validate bool // 生成 EPUB 后检查是否符合规范
+
+	// 页面模板(Go html/template), 为空时使用内置的页面
+	ChapterTemplate      string             // 章节页面模板
+	VolumeTemplate       string             // 卷页面模板
+	TitlePageTemplate    string             // 书名页模板, 设置后在正文前添加书名页
+	ColophonPageTemplate string             // 版权页模板, 设置后添加版权页
+	AboutPageTemplate    string             // 内容简介页模板, 设置后添加内容简介页
+	TocPageTemplate      string             // 目录页模板, 开启目录页时使用
+	Templates            *template.Template // 编译后的页面模板
+
+	// 正文前的页面
+	TitlePage    bool   // 添加书名页: 书名、作者和系列
+	ColophonPage bool   // 添加版权页: 来源、转换日期和软件版本
+	AboutPage    bool   // 添加内容简介页
+	Source       string // 来源, 显示在版权页中, 如网址或底本
+
+	// 分册
+	SplitChapters int // 每册最多章节数, 超出时拆分为多册, 0 表示不拆分
+	SplitChars    int // 每册最多字数
+	SplitTextSize int // 每册正文最大 MB 数, 按未压缩的正文估算, 不是输出文件的大小
+
+	// 书籍信息识别
+	FilenamePatterns []string // 从文件名(不含扩展名)提取书籍信息的正则, 命名分组: title, author, series, series_index
+	HeaderLines      int      // 文件开头书籍信息(书名：、作者：、内容简介：)占用的行数, 解析正文时跳过
+
+	// 输入格式
+	InputFormat string // 输入格式: auto(自动识别), txt(普通文本), aozora(青空文库)
+
+	// 脚注
+	FootnoteMatch string         // 脚注标记正则，设置为false可以禁用脚注识别
+	FootnoteReg   *regexp.Regexp // 编译后的脚注标记正则
+
+	// 版式
+	WritingMode    string // 排版方向: horizontal(横排), vertical(竖排, 从右向左翻页)
+	FirstParagraph string // 章节首段样式: none(不处理), dropcap(首字下沉), firstline(首行加粗), both(首字下沉和首行加粗)
+
+	// 注音
+	Ruby string // 注音处理方式: ruby(生成ruby标签), strip(去除注音), false(不处理)
+
+	// 编码错误报告
+	DecodeReport    bool          // 是否输出编码错误详细报告（含行号）
+	MaxDecodeErrors int           // 无法解码字符数上限，超过时转换失败，0 表示不限制
+	DecodeIssues    *DecodeReport // 解析时收集到的编码错误
+
+	// 临时文件
+	TempDir string // 转换过程中生成的封面等临时文件所在目录, 转换结束后删除
+
 	Decoder                *encoding.Decoder
 	PageStylesFile         string
 	Reg                    *regexp.Regexp
@@ -77,9 +182,23 @@ type Book struct {
 }
 
 type Section struct {
-	Title    string
-	Content  string
-	Sections []Section
+	Title     string
+	Content   string
+	Sections  []Section
+	Footnotes []Footnote // 章节内的脚注，正文中以 a.noteref 链接引用
+	Tips      bool       // 是否为制作说明, 不作为正文开始位置
+}
+
+// Footnote 脚注，ID 在整本书内唯一
+type Footnote struct {
+	ID      string // 脚注锚点, 如 note-3, 引用处锚点为 noteref-3
+	Label   string // 原文中的标记, 如 [1]、〔注1〕
+	Content string
+}
+
+// RefID 返回正文中引用该脚注的锚点
+func (note Footnote) RefID() string {
+	return strings.Replace(note.ID, "note-", "noteref-", 1)
 }
 
 func SectionCount(sections []Section) int {
@@ -103,7 +222,39 @@ func SetDefault(book *Book) {
 	book.Lang = utils.DefaultString(book.Lang, utils.GetEnv("KAF_CLI_LANG", "zh"))
 	book.Format = utils.DefaultString(book.Format, utils.GetEnv("KAF_CLI_FORMAT", "all"))
 	book.CoverOrlyIdx = utils.DefalutInt(book.CoverOrlyIdx, -1)
+	book.CoverSize = utils.DefaultString(book.CoverSize, "1600x2560")
+	book.CoverFit = utils.DefaultString(book.CoverFit, "letterbox")
+	book.CoverQuality = utils.DefalutInt(book.CoverQuality, 90)
 	book.ExclusionPattern = utils.DefaultString(book.ExclusionPattern, DefaultExclusion) // 默认排除规则
+	book.FootnoteMatch = utils.DefaultString(book.FootnoteMatch, DefaultFootnoteMatch)
+	book.Ruby = utils.DefaultString(book.Ruby, "ruby")
+	book.InputFormat = utils.DefaultString(book.InputFormat, "auto")
+	book.WritingMode = utils.DefaultString(book.WritingMode, "horizontal")
+	book.OutputLayout = utils.DefaultString(book.OutputLayout, "flat")
+	book.TipsPosition = utils.DefaultString(book.TipsPosition, "both")
+	book.FirstParagraph = utils.DefaultString(book.FirstParagraph, "none")
+}
+
+// MakeTempDir 创建本次转换使用的临时目录, 多次调用返回同一个目录
+func (book *Book) MakeTempDir() (string, error) {
+	if book.TempDir != "" {
+		return book.TempDir, nil
+	}
+	dir, err := os.MkdirTemp("", "kaf-cli")
+	if err != nil {
+		return "", err
+	}
+	book.TempDir = dir
+	return dir, nil
+}
+
+// Cleanup 删除转换过程中生成的临时文件
+func (book *Book) Cleanup() {
+	if book.TempDir == "" {
+		return
+	}
+	os.RemoveAll(book.TempDir)
+	book.TempDir = ""
 }
 
 func (book *Book) ToString() {
@@ -112,6 +263,9 @@ func (book *Book) ToString() {
 	fmt.Println("文件名:\t", book.Filename)
 	fmt.Println("书籍书名:", book.Bookname)
 	fmt.Println("书籍作者:", book.Author)
+	if book.Series != "" {
+		fmt.Println("所属系列:", book.Series, book.SeriesIndex)
+	}
 	if book.Cover != "" {
 		fmt.Println("书籍封面:", book.Cover)
 	}
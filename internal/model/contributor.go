@@ -0,0 +1,99 @@
+package model
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MARC 角色代码: https://id.loc.gov/vocabulary/relators.html
+const (
+	RoleAuthor      = "aut"
+	RoleTranslator  = "trl"
+	RoleEditor      = "edt"
+	RoleIllustrator = "ill"
+)
+
+// Contributor 作者、译者等参与者
+type Contributor struct {
+	Name string
+	Role string // MARC 角色代码
+}
+
+var contributorSeparatorReg = regexp.MustCompile(`[、&＆,，;；]`)
+
+// roleSuffixReg 名字后面用空格或括号隔开的角色说明, 如 鲁迅 著、许渊冲（译）
+var roleSuffixReg = regexp.MustCompile(`^(.+?)(?:\s+|\s*[(（\[【])(编著|主编|编辑|翻译|插画|著|编|译|绘)[)）\]】]?$`)
+
+var suffixRoles = map[string]string{
+	"编著": RoleAuthor,
+	"著":  RoleAuthor,
+	"主编": RoleEditor,
+	"编辑": RoleEditor,
+	"编":  RoleEditor,
+	"翻译": RoleTranslator,
+	"译":  RoleTranslator,
+	"插画": RoleIllustrator,
+	"绘":  RoleIllustrator,
+}
+
+// ParseContributors 解析用顿号、&或逗号分隔的名字, 名字后面有 著/译/编/绘 时使用对应的角色, 否则使用 role
+func ParseContributors(names, role string) []Contributor {
+	var list []Contributor
+	for _, name := range contributorSeparatorReg.Split(names, -1) {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		c := Contributor{Name: name, Role: role}
+		if group := roleSuffixReg.FindStringSubmatch(name); group != nil {
+			c = Contributor{Name: strings.TrimSpace(group[1]), Role: suffixRoles[group[2]]}
+		}
+		list = append(list, c)
+	}
+	return list
+}
+
+// ContributorList 返回作者、译者、编者和插画作者, 相同名字和角色只保留一个
+func (book *Book) ContributorList() []Contributor {
+	var list []Contributor
+	seen := map[Contributor]bool{}
+	for _, field := range []struct{ names, role string }{
+		{book.Author, RoleAuthor},
+		{book.Translator, RoleTranslator},
+		{book.Editor, RoleEditor},
+		{book.Illustrator, RoleIllustrator},
+	} {
+		for _, c := range ParseContributors(field.names, field.role) {
+			if !seen[c] {
+				seen[c] = true
+				list = append(list, c)
+			}
+		}
+	}
+	return list
+}
+
+// Authors 返回作者名字列表, 没有作者时返回原始的作者信息
+func (book *Book) Authors() []string {
+	var authors []string
+	for _, c := range book.ContributorList() {
+		if c.Role == RoleAuthor {
+			authors = append(authors, c.Name)
+		}
+	}
+	if len(authors) == 0 && book.Author != "" {
+		authors = []string{book.Author}
+	}
+	return authors
+}
+
+// OtherContributors 返回作者以外的参与者
+func (book *Book) OtherContributors() []Contributor {
+	var list []Contributor
+	for _, c := range book.ContributorList() {
+		if c.Role != RoleAuthor {
+			list = append(list, c)
+		}
+	}
+	return list
+}
@@ -0,0 +1,103 @@
+package model
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Identifier 书籍标识符, 如 isbn:9787020002207
+type Identifier struct {
+	Scheme string
+	Value  string
+}
+
+// pubDateLayouts 支持的出版日期格式
+var pubDateLayouts = []string{"2006-01-02", "2006-01", "2006"}
+
+var tagSeparatorReg = regexp.MustCompile(`[,，、;；]`)
+
+// TagList 返回标签列表, 标签之间可以用逗号、顿号或分号分隔
+func (book *Book) TagList() []string {
+	var tags []string
+	for _, tag := range tagSeparatorReg.Split(book.Tags, -1) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// IdentifierList 返回 ISBN 和其他标识符, 其他标识符格式为 scheme:value, 多个用逗号分隔
+func (book *Book) IdentifierList() []Identifier {
+	var ids []Identifier
+	if isbn := strings.ReplaceAll(strings.TrimSpace(book.ISBN), "-", ""); isbn != "" {
+		ids = append(ids, Identifier{Scheme: "isbn", Value: isbn})
+	}
+	for _, item := range tagSeparatorReg.Split(book.Identifiers, -1) {
+		scheme, value, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok || strings.TrimSpace(value) == "" {
+			continue
+		}
+		ids = append(ids, Identifier{Scheme: strings.ToLower(strings.TrimSpace(scheme)), Value: strings.TrimSpace(value)})
+	}
+	return ids
+}
+
+// PublishedTime 解析出版日期, 未设置时返回零值
+func (book *Book) PublishedTime() (time.Time, error) {
+	if book.PubDate == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range pubDateLayouts {
+		if t, err := time.Parse(layout, book.PubDate); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("出版日期格式错误: %s, 应为 2006-01-02、2006-01 或 2006", book.PubDate)
+}
+
+// CheckMetadata 检查元数据格式
+func (book *Book) CheckMetadata() error {
+	if _, err := book.PublishedTime(); err != nil {
+		return err
+	}
+	if book.SeriesIndex != "" {
+		if _, err := strconv.ParseFloat(book.SeriesIndex, 64); err != nil {
+			return fmt.Errorf("系列序号应为数字: %s", book.SeriesIndex)
+		}
+	}
+	return nil
+}
+
+// identityHash 书籍标识的哈希: 设置了 BookID 时使用 BookID, 否则使用书名、作者、语言和系列
+// 只修改正文时标识不变, 阅读器会把新文件当作同一本书, 保留阅读进度
+func (book *Book) identityHash() [sha1.Size]byte {
+	if book.BookID != "" {
+		return sha1.Sum([]byte(book.BookID))
+	}
+	parts := []string{"kaf-cli", book.Bookname, strings.Join(book.Authors(), "&"), book.Lang, book.Series, book.SeriesIndex}
+	return sha1.Sum([]byte(strings.Join(parts, "\x00")))
+}
+
+// UID 返回 EPUB 的唯一标识, 未设置 BookID 时生成固定的 urn:uuid
+func (book *Book) UID() string {
+	if book.BookID != "" {
+		return book.BookID
+	}
+	sum := book.identityHash()
+	// 按 UUID v5 的格式设置版本和变体
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// UniqueID 返回 Kindle 格式的唯一编号, 分册的书名不同, 编号也不同
+func (book *Book) UniqueID() uint32 {
+	sum := book.identityHash()
+	return binary.BigEndian.Uint32(sum[:4])
+}
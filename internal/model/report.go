@@ -0,0 +1,72 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DecodeIssue 记录某一行中无法解码的字节和替换字符
+type DecodeIssue struct {
+	Line         int    // 行号（从1开始）
+	InvalidBytes int    // 无效的 UTF-8 字节数
+	Replacements int    // U+FFFD 替换字符数（包括解码失败后被替换的字符）
+	Text         string // 出错行的内容片段
+}
+
+// ChapterDecodeIssues 单个章节内的解码问题
+type ChapterDecodeIssues struct {
+	Title  string
+	Issues []DecodeIssue
+}
+
+// DecodeReport 按章节汇总的解码问题报告
+type DecodeReport struct {
+	Encoding string // 识别出的文件编码
+	Chapters []ChapterDecodeIssues
+}
+
+// Add 把一行的解码问题记录到对应章节下
+func (r *DecodeReport) Add(title string, issue DecodeIssue) {
+	if n := len(r.Chapters); n > 0 && r.Chapters[n-1].Title == title {
+		r.Chapters[n-1].Issues = append(r.Chapters[n-1].Issues, issue)
+		return
+	}
+	r.Chapters = append(r.Chapters, ChapterDecodeIssues{
+		Title:  title,
+		Issues: []DecodeIssue{issue},
+	})
+}
+
+// Total 返回无法解码的字节和替换字符总数
+func (r *DecodeReport) Total() int {
+	if r == nil {
+		return 0
+	}
+	var total int
+	for _, chapter := range r.Chapters {
+		for _, issue := range chapter.Issues {
+			total += issue.InvalidBytes + issue.Replacements
+		}
+	}
+	return total
+}
+
+// String 生成可读的报告文本
+func (r *DecodeReport) String() string {
+	var buff strings.Builder
+	fmt.Fprintf(&buff, "编码错误报告 (文件编码: %s, 共 %d 处):\n", r.Encoding, r.Total())
+	for _, chapter := range r.Chapters {
+		fmt.Fprintf(&buff, "  %s\n", chapter.Title)
+		for _, issue := range chapter.Issues {
+			fmt.Fprintf(&buff, "    第 %d 行: ", issue.Line)
+			if issue.InvalidBytes > 0 {
+				fmt.Fprintf(&buff, "无效字节 %d 个 ", issue.InvalidBytes)
+			}
+			if issue.Replacements > 0 {
+				fmt.Fprintf(&buff, "替换字符 %d 个 ", issue.Replacements)
+			}
+			fmt.Fprintf(&buff, "| %s\n", issue.Text)
+		}
+	}
+	return buff.String()
+}
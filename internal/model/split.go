@@ -0,0 +1,202 @@
+package model
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/feewg/kaf-cli/internal/utils"
+)
+
+// SplitLimit 分册上限, 字段为 0 表示不限制
+type SplitLimit struct {
+	Chapters int // 每册最多章节数(卷也计为一章)
+	Chars    int // 每册最多字数
+	Bytes    int // 每册正文最大字节数, 按未压缩的正文估算, 不含图片和字体
+}
+
+// IsZero 是否没有设置任何上限
+func (l SplitLimit) IsZero() bool {
+	return l.Chapters <= 0 && l.Chars <= 0 && l.Bytes <= 0
+}
+
+func (l SplitLimit) exceeded(s sectionSize) bool {
+	return (l.Chapters > 0 && s.chapters > l.Chapters) ||
+		(l.Chars > 0 && s.chars > l.Chars) ||
+		(l.Bytes > 0 && s.bytes > l.Bytes)
+}
+
+// SplitLimit 返回书籍设置的分册上限
+func (book *Book) SplitLimit() SplitLimit {
+	return SplitLimit{
+		Chapters: book.SplitChapters,
+		Chars:    book.SplitChars,
+		Bytes:    book.SplitTextSize * 1024 * 1024,
+	}
+}
+
+type sectionSize struct {
+	chapters, chars, bytes int
+}
+
+func (s sectionSize) add(o sectionSize) sectionSize {
+	return sectionSize{s.chapters + o.chapters, s.chars + o.chars, s.bytes + o.bytes}
+}
+
+func sizeOf(section Section) sectionSize {
+	size := sectionSize{
+		chapters: 1,
+		chars:    utf8.RuneCountInString(section.Content),
+		bytes:    len(section.Title) + len(section.Content),
+	}
+	for _, note := range section.Footnotes {
+		size.chars += utf8.RuneCountInString(note.Content)
+		size.bytes += len(note.Content)
+	}
+	for _, sub := range section.Sections {
+		size = size.add(sizeOf(sub))
+	}
+	return size
+}
+
+// SplitSections 按上限拆分章节列表, 优先在卷之间拆分
+// 单卷超出上限时才拆开卷内章节, 拆开后的部分保留卷标题但不重复卷正文
+func SplitSections(sections []Section, limit SplitLimit) [][]Section {
+	if limit.IsZero() {
+		return [][]Section{sections}
+	}
+	var parts [][]Section
+	var current []Section
+	var size sectionSize
+	flush := func() {
+		if len(current) > 0 {
+			parts = append(parts, current)
+			current, size = nil, sectionSize{}
+		}
+	}
+	for _, section := range sections {
+		sectionSize := sizeOf(section)
+		if !limit.exceeded(size.add(sectionSize)) {
+			current = append(current, section)
+			size = size.add(sectionSize)
+			continue
+		}
+		// 整卷可以放入新的一册时在卷之前拆分
+		if len(section.Sections) == 0 || !limit.exceeded(sectionSize) {
+			flush()
+			current = append(current, section)
+			size = sectionSize
+			continue
+		}
+		// 卷本身超出上限, 第一部分接在当前册之后
+		piece := section
+		piece.Sections = nil
+		size = size.add(sizeOf(piece))
+		for _, sub := range section.Sections {
+			subSize := sizeOf(sub)
+			if limit.exceeded(size.add(subSize)) {
+				if len(piece.Sections) > 0 {
+					current = append(current, piece)
+					piece = Section{Title: section.Title}
+				}
+				flush()
+				size = sizeOf(piece)
+			}
+			piece.Sections = append(piece.Sections, sub)
+			size = size.add(subSize)
+		}
+		current = append(current, piece)
+	}
+	flush()
+	if len(parts) == 0 {
+		parts = append(parts, current)
+	}
+	return parts
+}
+
+// Parts 按上限把书籍拆分为多册
+// 每册书名为 "书名 (卷一)", 没有设置系列时以原书名作为系列名, 册序号作为系列序号;
+// 已设置系列序号时各册使用子序号, 如 3.1、3.2
+func (book Book) Parts(limit SplitLimit) []Book {
+	chunks := SplitSections(book.SectionList, limit)
+	if len(chunks) == 1 {
+		return []Book{book}
+	}
+	parts := make([]Book, len(chunks))
+	for i, chunk := range chunks {
+		part := book
+		label := PartLabel(book.Lang, i+1)
+		part.SectionList = chunk
+		part.Bookname = fmt.Sprintf("%s (%s)", book.Bookname, label)
+		part.Out = fmt.Sprintf("%s (%s)", book.Out, label)
+		// Calibre 目录结构下每册单独一个目录
+		if book.OutputLayout == "calibre" {
+			name := filepath.Base(part.Out)
+			part.Out = filepath.Join(filepath.Dir(filepath.Dir(book.Out)), name, name)
+		}
+		// 设置了 BookID 时每册添加序号, 避免各册标识相同
+		if book.BookID != "" {
+			part.BookID = fmt.Sprintf("%s-%d", book.BookID, i+1)
+		}
+		switch {
+		case book.Series == "":
+			part.Series = book.Bookname
+			part.SeriesIndex = strconv.Itoa(i + 1)
+		case book.SeriesIndex == "":
+			part.SeriesIndex = strconv.Itoa(i + 1)
+		default:
+			part.SeriesIndex = subSeriesIndex(book.SeriesIndex, i+1, len(chunks))
+		}
+		parts[i] = part
+	}
+	return parts
+}
+
+// subSeriesIndex 返回第 n 册的子序号, 如 3 的第 2 册为 3.2, 1.5 的第 2 册为 1.52
+// 共 10 册以上时补零, 保证按数字排序时顺序正确
+func subSeriesIndex(index string, n, total int) string {
+	sub := fmt.Sprintf("%0*d", len(strconv.Itoa(total)), n)
+	if strings.Contains(index, ".") {
+		return index + sub
+	}
+	return index + "." + sub
+}
+
+// PartLabel 返回分册名称, 中文和日文为 卷一、卷二, 其他语言为 Vol. 1
+func PartLabel(lang string, n int) string {
+	switch utils.LangBase(lang) {
+	case "zh", "ja":
+		return "卷" + chineseNumber(n)
+	}
+	return fmt.Sprintf("Vol. %d", n)
+}
+
+// chineseNumber 把 1-9999 转换为中文数字, 超出范围时使用阿拉伯数字
+func chineseNumber(n int) string {
+	if n <= 0 || n >= 10000 {
+		return strconv.Itoa(n)
+	}
+	digits := []rune("零一二三四五六七八九")
+	units := []string{"千", "百", "十", ""}
+	var ret []rune
+	var zero bool
+	for i, base := range []int{1000, 100, 10, 1} {
+		d := n / base % 10
+		if d == 0 {
+			zero = len(ret) > 0
+			continue
+		}
+		if zero {
+			ret = append(ret, digits[0])
+			zero = false
+		}
+		// 十一 而不是 一十一
+		if !(d == 1 && base == 10 && len(ret) == 0) {
+			ret = append(ret, digits[d])
+		}
+		ret = append(ret, []rune(units[i])...)
+	}
+	return string(ret)
+}
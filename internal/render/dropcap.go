@@ -0,0 +1,98 @@
+package render
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/feewg/kaf-cli/internal/model"
+)
+
+// contentStart 正文段落的开始标签, 与解析时生成的段落一致
+const contentStart = `<p class="content">`
+
+// openingPunct 与首字一起放大的开头标点
+const openingPunct = "“‘「『（《〈\"'([«"
+
+// dropCapCSS 首字下沉: 首字浮动在段落左侧
+// Kindle 的浮动首字会和正文重叠或错位, KF8 改为不浮动的放大首字
+const dropCapCSS = `
+            p.first { text-indent: 0; }
+            p.first span.first-letter {
+                float: left;
+                font-size: 3em;
+                line-height: 1;
+                margin: 0.05em 0.1em 0 0;
+            }
+            @media amzn-kf8 {
+                p.first span.first-letter {
+                    float: none;
+                    font-size: 1.8em;
+                    line-height: 1em;
+                    margin: 0;
+                }
+            }
+`
+
+// verticalDropCapCSS 竖排时浮动方向不一致, 使用不浮动的放大首字
+const verticalDropCapCSS = `
+            p.first span.first-letter {
+                float: none;
+                font-size: 1.8em;
+                line-height: 1em;
+                margin: 0;
+            }
+`
+
+// firstLineCSS 首段首行加粗, 不支持 ::first-line 的阅读器按普通段落显示
+const firstLineCSS = `
+            p.first::first-line { font-weight: bold; }
+`
+
+// HasDropCap 是否使用首字下沉
+func HasDropCap(book model.Book) bool {
+	return book.FirstParagraph == "dropcap" || book.FirstParagraph == "both"
+}
+
+// markFirst 是否标记章节首段
+func markFirst(book model.Book) bool {
+	return book.FirstParagraph != "" && book.FirstParagraph != "none"
+}
+
+// firstParagraphCSS 按首段样式生成样式
+func firstParagraphCSS(book model.Book) string {
+	var css string
+	if HasDropCap(book) {
+		css += dropCapCSS
+		if IsVertical(book) {
+			css += verticalDropCapCSS
+		}
+	}
+	if book.FirstParagraph == "firstline" || book.FirstParagraph == "both" {
+		css += firstLineCSS
+	}
+	return css
+}
+
+// markFirstParagraph 给第一个正文段落加上 first 类, 首字(连同前面的开头标点)放在 span.first-letter 中
+// 段落以标签或字符实体开头时只标记段落
+func markFirstParagraph(content string) string {
+	i := strings.Index(content, contentStart)
+	if i < 0 {
+		return content
+	}
+	head := content[:i] + `<p class="content first">`
+	rest := content[i+len(contentStart):]
+	var n int
+	for _, r := range rest {
+		if !strings.ContainsRune(openingPunct, r) {
+			break
+		}
+		n += utf8.RuneLen(r)
+	}
+	r, size := utf8.DecodeRuneInString(rest[n:])
+	if size == 0 || r == '<' || r == '&' || r == utf8.RuneError {
+		return head + rest
+	}
+	n += size
+	return head + `<span class="first-letter">` + rest[:n] + `</span>` + rest[n:]
+}
@@ -0,0 +1,163 @@
+package render
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/feewg/kaf-cli/internal/utils"
+)
+
+// Page 正文前的书名页、版权页等页面
+type Page struct {
+	Name     string // 页面名称, EPUB 中的文件名为 Name.xhtml
+	Title    string // 页面标题
+	Landmark string // EPUB landmarks 中的类型, 为空时不写入
+	Body     string
+}
+
+// pageLabels 各语言页面中的文字, 没有对应语言时使用英文
+var pageLabels = map[string]map[string]string{
+	"zh": {
+		"colophon":  "版权信息",
+		"about":     "内容简介",
+		"title":     "书名",
+		"author":    "作者",
+		"publisher": "出版社",
+		"source":    "来源",
+		"date":      "转换日期",
+		"generator": "制作工具",
+		"sep":       "：",
+		"and":       "、",
+	},
+	"ja": {
+		"colophon":  "奥付",
+		"about":     "内容紹介",
+		"title":     "書名",
+		"author":    "著者",
+		"publisher": "出版社",
+		"source":    "底本",
+		"date":      "変換日",
+		"generator": "作成ツール",
+		"sep":       "：",
+		"and":       "、",
+	},
+	"en": {
+		"colophon":  "Colophon",
+		"about":     "About This Book",
+		"title":     "Title",
+		"author":    "Author",
+		"publisher": "Publisher",
+		"source":    "Source",
+		"date":      "Converted",
+		"generator": "Generated by",
+		"sep":       ": ",
+		"and":       ", ",
+	},
+}
+
+// pageLabel 按语言返回页面中的文字
+func pageLabel(lang, key string) string {
+	return utils.LangValue(pageLabels, lang, "en")[key]
+}
+
+// FrontMatter 按设置渲染正文前的书名页、版权页和内容简介页
+// 设置了对应的页面模板时按模板渲染, 没有内容简介时不生成内容简介页
+func (r *Renderer) FrontMatter() ([]Page, error) {
+	book := r.book
+	pages := []struct {
+		Page
+		template string
+		enabled  bool
+		body     func() string
+	}{
+		{Page{Name: "titlepage", Title: book.Bookname, Landmark: "titlepage"},
+			TitlePageTemplate, book.TitlePage, r.titlePage},
+		{Page{Name: "colophon", Title: pageLabel(book.Lang, "colophon"), Landmark: "copyright-page"},
+			ColophonPageTemplate, book.ColophonPage, r.colophonPage},
+		{Page{Name: "about", Title: pageLabel(book.Lang, "about")},
+			AboutPageTemplate, book.AboutPage && strings.TrimSpace(book.Description) != "", r.aboutPage},
+	}
+	var ret []Page
+	for _, p := range pages {
+		page := p.Page
+		switch {
+		case HasTemplate(book, p.template):
+			body, err := r.execute(p.template, PageData{Book: NewBookData(book)})
+			if err != nil {
+				return nil, err
+			}
+			page.Body = body
+		case p.enabled:
+			page.Body = p.body()
+			if IsVertical(book) {
+				page.Body = TateChuYoko(page.Body)
+			}
+		default:
+			continue
+		}
+		ret = append(ret, page)
+	}
+	return ret, nil
+}
+
+// titlePage 默认的书名页: 书名、作者和系列
+func (r *Renderer) titlePage() string {
+	book := r.book
+	var buff strings.Builder
+	buff.WriteString(`<div class="titlepage">`)
+	fmt.Fprintf(&buff, `<h1 class="book-title">%s</h1>`, html.EscapeString(book.Bookname))
+	if authors := book.Authors(); len(authors) > 0 {
+		fmt.Fprintf(&buff, `<p class="book-author">%s</p>`, html.EscapeString(strings.Join(authors, pageLabel(book.Lang, "and"))))
+	}
+	if book.Series != "" {
+		fmt.Fprintf(&buff, `<p class="book-series">%s</p>`, html.EscapeString(strings.TrimSpace(book.Series+" "+book.SeriesIndex)))
+	}
+	buff.WriteString(`</div>`)
+	return buff.String()
+}
+
+// colophonPage 默认的版权页: 书名、作者、出版信息、来源、转换日期和软件版本
+func (r *Renderer) colophonPage() string {
+	book := r.book
+	generator := "kaf-cli"
+	if book.Version != "" {
+		generator += " " + book.Version
+	}
+	var buff strings.Builder
+	fmt.Fprintf(&buff, `<div class="colophon"><h2 class="colophon-title">%s</h2>`, html.EscapeString(pageLabel(book.Lang, "colophon")))
+	for _, item := range [][2]string{
+		{"title", book.Bookname},
+		{"author", strings.Join(book.Authors(), pageLabel(book.Lang, "and"))},
+		{"publisher", book.Publisher},
+		{"ISBN", book.ISBN},
+		{"source", book.Source},
+		{"date", utils.SourceDate().Format("2006-01-02")},
+		{"generator", generator},
+	} {
+		if item[1] == "" {
+			continue
+		}
+		label := item[0]
+		if l := pageLabel(book.Lang, label); l != "" {
+			label = l
+		}
+		fmt.Fprintf(&buff, `<p>%s%s%s</p>`, html.EscapeString(label), pageLabel(book.Lang, "sep"), html.EscapeString(item[1]))
+	}
+	buff.WriteString(`</div>`)
+	return buff.String()
+}
+
+// aboutPage 默认的内容简介页, 简介中的每一行为一个段落
+func (r *Renderer) aboutPage() string {
+	book := r.book
+	var buff strings.Builder
+	fmt.Fprintf(&buff, `<div class="about"><h2 class="about-title">%s</h2>`, html.EscapeString(pageLabel(book.Lang, "about")))
+	for _, line := range strings.Split(book.Description, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			fmt.Fprintf(&buff, `<p class="content">%s</p>`, html.EscapeString(line))
+		}
+	}
+	buff.WriteString(`</div>`)
+	return buff.String()
+}
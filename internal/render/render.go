@@ -0,0 +1,254 @@
+// Package render 把章节渲染为 XHTML 片段, EPUB、AZW3 和 MOBI 共用同一份章节 HTML 和样式
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/feewg/kaf-cli/internal/model"
+	"github.com/feewg/kaf-cli/internal/utils"
+	xhtml "golang.org/x/net/html"
+)
+
+const (
+	titleStart  = `<h3 class="title">`
+	titleEnd    = "</h3>"
+	volumeStart = `<h2 class="volume">`
+	volumeEnd   = "</h2>"
+)
+
+// NoteStyle 脚注的输出方式
+type NoteStyle int
+
+const (
+	PopupNotes NoteStyle = iota // EPUB3 弹出式脚注
+	EndNotes                    // 章末尾注, 用于不支持弹出脚注的 Kindle 格式
+)
+
+// Renderer 按书籍设置渲染章节
+type Renderer struct {
+	book  model.Book
+	notes NoteStyle
+	// image 把页眉图片的路径转换为电子书中的地址, 返回空字符串时不显示页眉图片
+	image func(path string) string
+}
+
+// New 创建渲染器, image 为 nil 时不显示章节页眉图片
+func New(book model.Book, notes NoteStyle, image func(path string) string) *Renderer {
+	return &Renderer{book: book, notes: notes, image: image}
+}
+
+// Chapter 渲染章节或卷, 返回章节页面的 XHTML 片段
+// 卷只显示卷名和卷正文, 章节依次为页眉图片、标题和正文, 竖排时标记纵中横
+// 设置了章节或卷的页面模板时按模板渲染
+func (r *Renderer) Chapter(section model.Section, isVolume bool) (string, error) {
+	name := ChapterTemplate
+	if isVolume {
+		name = VolumeTemplate
+	}
+	if HasTemplate(r.book, name) {
+		return r.execute(name, r.chapterData(section, isVolume))
+	}
+	var buff bytes.Buffer
+	if isVolume {
+		// 卷名使用专门的样式
+		buff.WriteString(volumeStart)
+		buff.WriteString(section.Title)
+		buff.WriteString(volumeEnd)
+	} else {
+		buff.WriteString(r.headerImage(section.Title))
+		buff.WriteString(r.title(section.Title))
+	}
+	buff.WriteString(r.content(section, isVolume))
+	if IsVertical(r.book) {
+		return TateChuYoko(buff.String()), nil
+	}
+	return buff.String(), nil
+}
+
+// title 渲染章节标题, 设置了分离章节序号时序号单独一行
+func (r *Renderer) title(title string) string {
+	if !r.book.SeparateChapterNumber {
+		return titleStart + title + titleEnd
+	}
+	number, text := ParseChapterTitle(title)
+	if number == "" {
+		// 无序号，直接显示标题
+		return titleStart + title + titleEnd
+	}
+	return fmt.Sprintf(`%s<span class="chapter-number">%s</span>%s%s`, titleStart, number, text, titleEnd)
+}
+
+// content 渲染正文和脚注, 设置了首段样式时标记章节的第一个段落
+func (r *Renderer) content(section model.Section, isVolume bool) string {
+	if markFirst(r.book) && !isVolume && !section.Tips {
+		section.Content = markFirstParagraph(section.Content)
+	}
+	if r.notes == EndNotes {
+		return endnoteContent(section)
+	}
+	return popupNoteContent(section)
+}
+
+// headerImage 查找并渲染章节页眉图片
+func (r *Renderer) headerImage(title string) string {
+	if r.image == nil {
+		return ""
+	}
+	imgPath := FindHeaderImage(r.book, title)
+	if imgPath == "" {
+		return ""
+	}
+	src := r.image(imgPath)
+	if src == "" {
+		return ""
+	}
+	book := r.book
+	return HeaderImageHTML(src, book.ChapterHeaderImagePosition, book.ChapterHeaderImageHeight, book.ChapterHeaderImageWidth)
+}
+
+// popupNoteContent 生成 EPUB3 弹出式脚注：引用链接标记为 noteref，脚注内容放在 aside 中
+func popupNoteContent(section model.Section) string {
+	if len(section.Footnotes) == 0 {
+		return section.Content
+	}
+	var buff bytes.Buffer
+	buff.WriteString(strings.ReplaceAll(section.Content, `<a class="noteref"`, `<a class="noteref" epub:type="noteref"`))
+	for _, note := range section.Footnotes {
+		buff.WriteString(fmt.Sprintf(`<aside class="footnote" epub:type="footnote" id="%s"><p><a href="#%s">%s</a> %s</p></aside>`,
+			note.ID, note.RefID(), note.Label, note.Content))
+	}
+	return buff.String()
+}
+
+// endnoteContent 生成章末尾注，用于不支持 EPUB3 弹出脚注的 Kindle 格式
+func endnoteContent(section model.Section) string {
+	if len(section.Footnotes) == 0 {
+		return section.Content
+	}
+	var buff bytes.Buffer
+	buff.WriteString(section.Content)
+	buff.WriteString(`<div class="endnotes"><hr/>`)
+	for _, note := range section.Footnotes {
+		buff.WriteString(fmt.Sprintf(`<p class="endnote" id="%s"><a href="#%s">%s</a> %s</p>`,
+			note.ID, note.RefID(), note.Label, note.Content))
+	}
+	buff.WriteString(`</div>`)
+	return buff.String()
+}
+
+// HeaderImageHTML 生成章节页眉图片的HTML, src 为图片在电子书中的地址
+func HeaderImageHTML(src, position, height, width string) string {
+	var styleParts []string
+	if height != "" && height != "auto" {
+		styleParts = append(styleParts, fmt.Sprintf("height: %s;", height))
+	}
+	if width != "" && width != "auto" {
+		styleParts = append(styleParts, fmt.Sprintf("width: %s;", width))
+	}
+
+	style := ""
+	if len(styleParts) > 0 {
+		style = fmt.Sprintf(` style="%s"`, strings.Join(styleParts, " "))
+	}
+
+	alignClass := "center"
+	switch position {
+	case "left":
+		alignClass = "left"
+	case "right":
+		alignClass = "right"
+	}
+
+	return fmt.Sprintf(`<div class="chapter-header-image %s"><img src="%s"%s alt="chapter header"/></div>`,
+		alignClass, src, style)
+}
+
+var (
+	headerImageCleanReg  = regexp.MustCompile(`[<>:"/\\|?*]`)
+	headerImageNumberReg = regexp.MustCompile(`\d+`)
+)
+
+// FindHeaderImage 根据章节名查找对应的页眉图片, 没有设置页眉图片时返回空字符串
+func FindHeaderImage(book model.Book, chapterTitle string) string {
+	if book.ChapterHeaderImageMode == "folder" && book.ChapterHeaderImageFolder != "" {
+		// 清理章节名用于文件匹配
+		cleanTitle := strings.TrimSpace(chapterTitle)
+		// 移除特殊字符
+		cleanTitle = headerImageCleanReg.ReplaceAllString(cleanTitle, "")
+
+		// 尝试多种图片扩展名
+		extensions := []string{".png", ".jpg", ".jpeg", ".gif", ".webp"}
+
+		for _, ext := range extensions {
+			// 完整匹配
+			imgPath := filepath.Join(book.ChapterHeaderImageFolder, cleanTitle+ext)
+			if exists, _ := utils.IsExists(imgPath); exists {
+				return imgPath
+			}
+
+			// 尝试数字匹配（如果章节名包含数字）
+			if nums := headerImageNumberReg.FindString(cleanTitle); nums != "" {
+				imgPath := filepath.Join(book.ChapterHeaderImageFolder, nums+ext)
+				if exists, _ := utils.IsExists(imgPath); exists {
+					return imgPath
+				}
+			}
+		}
+	}
+
+	// 返回通用图片
+	return book.ChapterHeaderImage
+}
+
+var (
+	chapterNumberRegs = []*regexp.Regexp{
+		// 匹配 "第X章/回/节/集" 格式
+		regexp.MustCompile(`^(第[0-9一二三四五六七八九十零〇百千两 ]+[章回节集])\s*(.*)$`),
+		// 匹配 "数字." 或 "数字、" 格式（使用字符串拼接来支持中文顿号）
+		regexp.MustCompile(`^(\d+[.` + string(rune(0x3001)) + `])\s*(.*)$`),
+		// 匹配 "中文数字、" 格式
+		regexp.MustCompile(`^([一二三四五六七八九十]+[.` + string(rune(0x3001)) + `])\s*(.*)$`),
+		// 匹配特殊章节名（引子、楔子、序章等）
+		regexp.MustCompile(`^(引子|楔子|序章|最终章|完本感言|番外)\s*(.*)$`),
+	}
+)
+
+// ParseChapterTitle 解析章节标题，返回序号和标题
+// 支持的格式：
+//
+//	"第一章 标题" -> number="第一章", text="标题"
+//	"第1章 标题" -> number="第1章", text="标题"
+//	"1. 标题" -> number="1.", text="标题"
+//	"一、标题" -> number="一、", text="标题"
+//	"引子" -> number="引子", text=""
+//	"卷名" -> number="", text="卷名"（没有匹配到序号）
+func ParseChapterTitle(title string) (number, text string) {
+	for _, re := range chapterNumberRegs {
+		if matches := re.FindStringSubmatch(title); matches != nil {
+			return matches[1], matches[2]
+		}
+	}
+	// 没有匹配到序号格式，返回空序号
+	return "", title
+}
+
+// PlainTitle 章节标题是 XHTML 片段, 目录和 <title> 中去掉标签并还原转义的字符
+func PlainTitle(title string) string {
+	if !strings.ContainsAny(title, "<&") {
+		return title
+	}
+	var buff strings.Builder
+	z := xhtml.NewTokenizer(strings.NewReader(title))
+	for {
+		switch z.Next() {
+		case xhtml.ErrorToken:
+			return buff.String()
+		case xhtml.TextToken:
+			buff.Write(z.Text())
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package render
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/feewg/kaf-cli/internal/model"
+)
+
+// 使用 go test ./internal/render -update 重新生成 testdata 中的期望结果
+var update = flag.Bool("update", false, "更新 testdata 中的 golden 文件")
+
+// checkGolden 比较渲染结果和 testdata/name.golden
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("读取 golden 文件失败: %v, 使用 -update 生成", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s 的渲染结果与 golden 文件不一致\n得到:\n%s\n期望:\n%s", name, got, want)
+	}
+}
+
+// testBook 渲染测试使用的书籍设置, 与命令行的默认值一致
+func testBook() model.Book {
+	return model.Book{
+		Bookname:       "测试书籍",
+		Author:         "作者",
+		Lang:           "zh",
+		Align:          "center",
+		Bottom:         "1em",
+		Indent:         2,
+		WritingMode:    "horizontal",
+		FirstParagraph: "none",
+	}
+}
+
+// noteSection 带两个脚注的章节, 第一个脚注被引用两次
+func noteSection() model.Section {
+	return model.Section{
+		Title: "第二章 注释",
+		Content: `<p class="content">正文<sup><a class="noteref" id="noteref-1" href="#note-1">[1]</a></sup>，` +
+			`再次引用<sup><a class="noteref" href="#note-1">[1]</a></sup>。</p>` +
+			`<p class="content">另一处<sup><a class="noteref" id="noteref-2" href="#note-2">[2]</a></sup>。</p>`,
+		Footnotes: []model.Footnote{
+			{ID: "note-1", Label: "[1]", Content: "第一个脚注"},
+			{ID: "note-2", Label: "[2]", Content: "第二个脚注"},
+		},
+	}
+}
+
+func TestChapter(t *testing.T) {
+	chapter := model.Section{
+		Title:   "第一章 开始",
+		Content: `<p class="content">第一段。</p><p class="content">第二段。</p>`,
+	}
+	image := func(path string) string {
+		return "../images/" + filepath.Base(path)
+	}
+	tests := []struct {
+		name     string
+		book     func(book *model.Book)
+		notes    NoteStyle
+		image    func(path string) string
+		section  model.Section
+		isVolume bool
+	}{
+		{
+			name: "volume",
+			section: model.Section{
+				Title:    "第一卷 起",
+				Content:  `<p class="content">卷首语。</p>`,
+				Sections: []model.Section{chapter},
+			},
+			isVolume: true,
+		},
+		{
+			name:    "chapter",
+			section: chapter,
+		},
+		{
+			name:    "separate_chapter_number",
+			book:    func(book *model.Book) { book.SeparateChapterNumber = true },
+			section: chapter,
+		},
+		{
+			name: "header_image",
+			book: func(book *model.Book) {
+				book.ChapterHeaderImage = "assets/header.png"
+				book.ChapterHeaderImagePosition = "left"
+				book.ChapterHeaderImageHeight = "3em"
+			},
+			image:   image,
+			section: chapter,
+		},
+		{
+			name:    "popup_notes",
+			notes:   PopupNotes,
+			section: noteSection(),
+		},
+		{
+			name:    "end_notes",
+			notes:   EndNotes,
+			section: noteSection(),
+		},
+		{
+			name: "vertical",
+			book: func(book *model.Book) { book.WritingMode = "vertical" },
+			section: model.Section{
+				Title:   "第12章 2024年",
+				Content: `<p class="content">第1話は2024年10月に公開、AB組の12人。</p>`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := testBook()
+			if tt.book != nil {
+				tt.book(&book)
+			}
+			got, err := New(book, tt.notes, tt.image).Chapter(tt.section, tt.isVolume)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, "chapter_"+tt.name, got)
+		})
+	}
+}
+
+func TestStylesheet(t *testing.T) {
+	tests := []struct {
+		name    string
+		book    func(book *model.Book)
+		fontURL string
+	}{
+		{name: "default"},
+		{
+			name: "custom",
+			book: func(book *model.Book) {
+				book.Align = "left"
+				book.Bottom = "0.5em"
+				book.Indent = 0
+				book.LineHeight = "1.8"
+				book.ExtendedCSS = "p { color: #333; }"
+				book.CSSVariables = "--accent: #c00; --gap: 1em"
+			},
+			fontURL: "../fonts/font.ttf",
+		},
+		{
+			name: "vertical",
+			book: func(book *model.Book) {
+				book.WritingMode = "vertical"
+				book.InputFormat = "aozora"
+				book.FirstParagraph = "both"
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := testBook()
+			if tt.book != nil {
+				tt.book(&book)
+			}
+			got, err := Stylesheet(book, tt.fontURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, "stylesheet_"+tt.name, got)
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package render
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/feewg/kaf-cli/internal/model"
+)
+
+// baseCSS 默认样式模板, 参数依次为标题对齐、段落间距、缩进、扩展样式
+const baseCSS = `
+            h2.volume {
+                text-align: center;
+                font-size: 2.2em;
+                margin: 1.5em 0 1em 0;
+                padding: 0.5em 0;
+                border-top: 3px double #666;
+                border-bottom: 3px double #666;
+                background: linear-gradient(to bottom, #f9f9f9, #ffffff);
+                font-weight: bold;
+            }
+            h3.title {
+                text-align: %s;
+                font-size: 1.8em;
+                margin: 1em 0;
+                border-bottom: 2px solid #ccc;
+            }
+            h3.title span.chapter-number {
+                display: block;
+                font-size: 0.65em;
+            }
+            .content { margin-bottom: %s; text-indent: %dem; %s }
+            
+            /* 章节页眉图片样式 */
+            .chapter-header-image {
+                display: block;
+                margin: 0 auto 1em auto;
+                max-width: 100%%;
+            }
+            .chapter-header-image.left { text-align: left; }
+            .chapter-header-image.center { text-align: center; }
+            .chapter-header-image.right { text-align: right; }
+
+            /* 脚注 */
+            a.noteref { text-decoration: none; }
+            aside.footnote { font-size: 0.85em; text-indent: 0; }
+            div.endnotes { font-size: 0.85em; }
+            p.endnote { text-indent: 0; }
+
+            /* 书名页、版权页和内容简介页 */
+            div.titlepage { text-align: center; padding-top: 20%%; }
+            h1.book-title { font-size: 2.2em; margin: 0 0 1.5em 0; }
+            p.book-author { font-size: 1.2em; text-indent: 0; margin: 0.5em 0; }
+            p.book-series { font-size: 1em; text-indent: 0; margin: 0.5em 0; color: #666; }
+            h2.colophon-title, h2.about-title { text-align: center; font-size: 1.4em; margin: 1em 0; }
+            div.colophon p { font-size: 0.9em; text-indent: 0; margin: 0.3em 0; }
+
+            /* 目录页 */
+            h2.toc-title { text-align: center; }
+            nav.toc-page ol { list-style-type: none; padding-left: 1em; }
+            nav.toc-page a { text-decoration: none; }
+        `
+
+// Stylesheet 生成书籍样式, 所有格式共用
+// fontURL 为嵌入字体在电子书中的地址, 为空时不使用嵌入字体
+func Stylesheet(book model.Book, fontURL string) (string, error) {
+	css := baseCSS
+	if IsVertical(book) {
+		css += verticalCSS
+	}
+	if IsAozora(book) {
+		css += aozoraCSS
+	}
+	var excss string
+	if book.LineHeight != "" {
+		excss = fmt.Sprintf("line-height: %s;", book.LineHeight)
+	}
+	if fontURL != "" {
+		excss += `
+font-family: "embedfont";
+`
+	}
+	css = fmt.Sprintf(css, book.Align, book.Bottom, book.Indent, excss)
+	css += firstParagraphCSS(book)
+	if fontURL != "" {
+		css += fmt.Sprintf(`
+@font-face {
+  font-family: "embedfont";
+  src: url(%s) format('truetype');
+}
+`, fontURL)
+	}
+
+	// 追加用户自定义 CSS
+	if book.CustomCSSFile != "" {
+		customCSS, err := os.ReadFile(book.CustomCSSFile)
+		if err != nil {
+			return "", fmt.Errorf("读取自定义CSS文件失败: %w", err)
+		}
+		css += string(customCSS)
+	}
+
+	// 追加内联扩展CSS
+	if book.ExtendedCSS != "" {
+		css += "\n/* 用户扩展CSS */\n" + book.ExtendedCSS
+	}
+
+	// 添加CSS变量
+	if book.CSSVariables != "" {
+		vars := ":root {\n"
+		pairs := strings.Split(book.CSSVariables, ";")
+		for _, pair := range pairs {
+			pair = strings.TrimSpace(pair)
+			if pair == "" {
+				continue
+			}
+			parts := strings.SplitN(pair, ":", 2)
+			if len(parts) == 2 {
+				vars += fmt.Sprintf("  %s: %s;\n", strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+			}
+		}
+		vars += "}\n"
+		css = vars + css
+	}
+	return css, nil
+}
+
+// aozoraCSS 青空文库注记对应的样式：傍点、傍线、纵中横和小见出し
+// 作为样式模板片段追加在 baseCSS 之后
+const aozoraCSS = `
+em.sesame, em.sesame-open, em.dot, em.dot-open, em.double-circle, em.triangle, em.triangle-open { font-style: normal; }
+em.sesame { text-emphasis-style: filled sesame; -webkit-text-emphasis-style: filled sesame; -epub-text-emphasis-style: filled sesame; }
+em.sesame-open { text-emphasis-style: open sesame; -webkit-text-emphasis-style: open sesame; -epub-text-emphasis-style: open sesame; }
+em.dot { text-emphasis-style: filled circle; -webkit-text-emphasis-style: filled circle; -epub-text-emphasis-style: filled circle; }
+em.dot-open { text-emphasis-style: open circle; -webkit-text-emphasis-style: open circle; -epub-text-emphasis-style: open circle; }
+em.double-circle { text-emphasis-style: filled double-circle; -webkit-text-emphasis-style: filled double-circle; -epub-text-emphasis-style: filled double-circle; }
+em.triangle { text-emphasis-style: filled triangle; -webkit-text-emphasis-style: filled triangle; -epub-text-emphasis-style: filled triangle; }
+em.triangle-open { text-emphasis-style: open triangle; -webkit-text-emphasis-style: open triangle; -epub-text-emphasis-style: open triangle; }
+span.underline { text-decoration: underline; }
+span.tcy { text-combine-upright: all; -webkit-text-combine: horizontal; -epub-text-combine: horizontal; }
+h4.subtitle { font-size: 1.2em; margin: 1em 0; }`
+
+// IsAozora 是否为青空文库格式的输入
+func IsAozora(book model.Book) bool {
+	return book.InputFormat == "aozora"
+}
@@ -0,0 +1,179 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+
+	"github.com/feewg/kaf-cli/internal/model"
+	"github.com/feewg/kaf-cli/internal/utils"
+)
+
+// 页面模板名称
+const (
+	ChapterTemplate      = "chapter"       // 章节页面
+	VolumeTemplate       = "volume"        // 卷页面
+	TitlePageTemplate    = "title_page"    // 书名页
+	ColophonPageTemplate = "colophon_page" // 版权页
+	AboutPageTemplate    = "about_page"    // 内容简介页
+	TocPageTemplate      = "toc_page"      // 目录页
+)
+
+// ParseTemplates 读取并编译用户设置的页面模板, 没有设置任何模板时不做处理
+func ParseTemplates(book *model.Book) error {
+	files := []struct{ name, path string }{
+		{ChapterTemplate, book.ChapterTemplate},
+		{VolumeTemplate, book.VolumeTemplate},
+		{TitlePageTemplate, book.TitlePageTemplate},
+		{ColophonPageTemplate, book.ColophonPageTemplate},
+		{AboutPageTemplate, book.AboutPageTemplate},
+		{TocPageTemplate, book.TocPageTemplate},
+	}
+	tmpl := template.New("pages")
+	var parsed bool
+	for _, f := range files {
+		if f.path == "" {
+			continue
+		}
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return fmt.Errorf("读取页面模板失败: %w", err)
+		}
+		if _, err := tmpl.New(f.name).Parse(string(data)); err != nil {
+			return fmt.Errorf("解析页面模板 %s 失败: %w", f.path, err)
+		}
+		parsed = true
+	}
+	if parsed {
+		book.Templates = tmpl
+	}
+	return nil
+}
+
+// HasTemplate 是否设置了指定的页面模板
+func HasTemplate(book model.Book, name string) bool {
+	return book.Templates != nil && book.Templates.Lookup(name) != nil
+}
+
+// BookData 模板中的书籍信息
+type BookData struct {
+	Title        string   // 书名
+	Authors      []string // 作者
+	Translators  []string // 译者
+	Editors      []string // 编者
+	Illustrators []string // 插画作者
+	Series       string   // 系列名
+	SeriesIndex  string   // 系列序号
+	Description  string   // 内容简介
+	Publisher    string   // 出版社
+	PubDate      string   // 出版日期
+	ISBN         string
+	Tags         []string
+	Lang         string // 语言
+	Vertical     bool   // 是否竖排
+	Source       string // 来源
+	Date         string // 转换日期, 如 2006-01-02
+	Version      string // kaf-cli 版本
+}
+
+// NewBookData 从书籍设置生成模板中的书籍信息
+func NewBookData(book model.Book) BookData {
+	data := BookData{
+		Title:       book.Bookname,
+		Authors:     book.Authors(),
+		Series:      book.Series,
+		SeriesIndex: book.SeriesIndex,
+		Description: book.Description,
+		Publisher:   book.Publisher,
+		PubDate:     book.PubDate,
+		ISBN:        book.ISBN,
+		Tags:        book.TagList(),
+		Lang:        book.Lang,
+		Vertical:    IsVertical(book),
+		Source:      book.Source,
+		Date:        utils.SourceDate().Format("2006-01-02"),
+		Version:     book.Version,
+	}
+	for _, c := range book.OtherContributors() {
+		switch c.Role {
+		case model.RoleTranslator:
+			data.Translators = append(data.Translators, c.Name)
+		case model.RoleEditor:
+			data.Editors = append(data.Editors, c.Name)
+		case model.RoleIllustrator:
+			data.Illustrators = append(data.Illustrators, c.Name)
+		}
+	}
+	return data
+}
+
+// ChapterData 章节和卷页面模板的数据
+type ChapterData struct {
+	Book        BookData
+	Title       string        // 标题纯文本
+	TitleHTML   template.HTML // 标题, 可能包含注音等标签
+	Number      string        // 章节序号, 如 第一章, 没有序号时为空
+	Text        string        // 去掉序号后的标题
+	HeaderImage template.HTML // 页眉图片, 没有时为空
+	Content     template.HTML // 正文和脚注
+	Volume      bool          // 是否为卷
+}
+
+// TocItem 目录页中的一项, Href 相对于目录页
+type TocItem struct {
+	Title    string
+	Href     string
+	Children []TocItem
+}
+
+// TocData 目录页模板的数据
+type TocData struct {
+	Book  BookData
+	Title string // 目录标题, 按语言为 目录、目次 或 Table of Contents
+	Items []TocItem
+}
+
+// PageData 书名页、版权页和内容简介页模板的数据
+type PageData struct {
+	Book BookData
+}
+
+// execute 执行页面模板, 竖排时标记纵中横
+func (r *Renderer) execute(name string, data any) (string, error) {
+	var buff bytes.Buffer
+	if err := r.book.Templates.ExecuteTemplate(&buff, name, data); err != nil {
+		return "", fmt.Errorf("执行页面模板失败: %w", err)
+	}
+	if IsVertical(r.book) {
+		return TateChuYoko(buff.String()), nil
+	}
+	return buff.String(), nil
+}
+
+// chapterData 生成章节页面模板的数据
+func (r *Renderer) chapterData(section model.Section, isVolume bool) ChapterData {
+	title := PlainTitle(section.Title)
+	number, text := ParseChapterTitle(title)
+	data := ChapterData{
+		Book:      NewBookData(r.book),
+		Title:     title,
+		TitleHTML: template.HTML(section.Title),
+		Number:    number,
+		Text:      text,
+		Content:   template.HTML(r.content(section, isVolume)),
+		Volume:    isVolume,
+	}
+	if !isVolume {
+		data.HeaderImage = template.HTML(r.headerImage(section.Title))
+	}
+	return data
+}
+
+// TocPage 按模板渲染目录页, 没有设置模板时返回空字符串
+func (r *Renderer) TocPage(title string, items []TocItem) (string, error) {
+	if !HasTemplate(r.book, TocPageTemplate) {
+		return "", nil
+	}
+	return r.execute(TocPageTemplate, TocData{Book: NewBookData(r.book), Title: title, Items: items})
+}
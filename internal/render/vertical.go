@@ -0,0 +1,111 @@
+package render
+
+import (
+	"strings"
+
+	"github.com/feewg/kaf-cli/internal/model"
+)
+
+// verticalCSS 竖排样式：段落间距改为左边距，标题和卷名的边框随之旋转
+// 作为样式模板片段追加在 baseCSS 之后，参数顺序相同（对齐、段落间距、缩进、扩展样式）
+const verticalCSS = `
+            html {
+                writing-mode: vertical-rl;
+                -webkit-writing-mode: vertical-rl;
+                -epub-writing-mode: vertical-rl;
+            }
+            h2.volume {
+                margin: 0 1em 0 1.5em;
+                padding: 0 0.5em;
+                border-top: none;
+                border-bottom: none;
+                border-right: 3px double #666;
+                border-left: 3px double #666;
+                background: none;
+            }
+            h3.title {
+                margin: 0 1em;
+                border-bottom: none;
+                border-left: 2px solid #ccc;
+            }
+            h3.title span.chapter-number { font-size: 0.65em; }
+            .content { margin-bottom: 0; margin-left: %[2]s; }
+            .chapter-header-image { margin: 0 0 0 1em; max-height: 100%%; }
+            div.titlepage { padding-top: 0; padding-right: 20%%; }
+            h1.book-title { margin: 0 0 0 1.5em; }
+            .tcy {
+                text-combine-upright: all;
+                -webkit-text-combine: horizontal;
+                -epub-text-combine: horizontal;
+            }
+`
+
+// IsVertical 是否为竖排版式
+func IsVertical(book model.Book) bool {
+	return book.WritingMode == "vertical"
+}
+
+// TateChuYoko 竖排时把两位以内的半角数字和 !? 之类的组合标记为纵中横
+// 只处理标签之间的文本，不影响标签属性中的数字
+func TateChuYoko(html string) string {
+	var buff strings.Builder
+	for len(html) > 0 {
+		idx := strings.IndexByte(html, '<')
+		if idx == -1 {
+			buff.WriteString(tcyText(html))
+			break
+		}
+		buff.WriteString(tcyText(html[:idx]))
+		end := strings.IndexByte(html[idx:], '>')
+		if end == -1 {
+			buff.WriteString(html[idx:])
+			break
+		}
+		buff.WriteString(html[idx : idx+end+1])
+		html = html[idx+end+1:]
+	}
+	return buff.String()
+}
+
+func tcyText(text string) string {
+	if !strings.ContainsAny(text, "0123456789!?") {
+		return text
+	}
+	var buff strings.Builder
+	for i := 0; i < len(text); {
+		j := i
+		switch {
+		case isDigit(text[i]):
+			for j < len(text) && isDigit(text[j]) {
+				j++
+			}
+		case text[i] == '!' || text[i] == '?':
+			for j < len(text) && (text[j] == '!' || text[j] == '?') {
+				j++
+			}
+		default:
+			buff.WriteByte(text[i])
+			i++
+			continue
+		}
+		// 实体（如 &#38;）和字母数字混排的内容保持原样
+		standalone := (i == 0 || !isASCIIWord(text[i-1])) && (j == len(text) || !isASCIIWord(text[j]))
+		if j-i <= 2 && standalone && !(j-i == 1 && !isDigit(text[i])) {
+			buff.WriteString(`<span class="tcy">`)
+			buff.WriteString(text[i:j])
+			buff.WriteString(`</span>`)
+		} else {
+			buff.WriteString(text[i:j])
+		}
+		i = j
+	}
+	return buff.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isASCIIWord(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '#' || c == '&' || c == '.'
+}
@@ -1,15 +1,23 @@
 ﻿package utils
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"image"
 	"io"
 	"math/rand"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var colors = []string{
@@ -32,47 +40,198 @@ var colors = []string{
 	"#75a500",
 }
 
-func GenCover(title, author, color string, img int) (string, error) {
+// 在线封面的下载限制
+const (
+	coverTimeout  = 30 * time.Second
+	maxCoverBytes = 20 << 20
+)
+
+// CoverRequest 在线生成封面的参数
+type CoverRequest struct {
+	Title  string
+	Author string
+	Color  string // 主题色: 1-16 或 hex 颜色代码, 为空时随机
+	Idx    int    // 图案编号, 超出范围时随机
+}
+
+// CoverProvider 在线封面服务
+type CoverProvider interface {
+	// Name 服务名称, 同时作为缓存键的一部分
+	Name() string
+	// Generate 生成封面并返回图片内容
+	Generate(ctx context.Context, req CoverRequest) ([]byte, error)
+}
+
+// OrlyProvider orly 风格封面服务: https://orly.nanmu.me
+type OrlyProvider struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewOrlyProvider 创建带超时的 orly 封面服务
+func NewOrlyProvider() *OrlyProvider {
+	return &OrlyProvider{
+		BaseURL: "https://orly.nanmu.me",
+		Client:  &http.Client{Timeout: coverTimeout},
+	}
+}
+
+func (p *OrlyProvider) Name() string {
+	return "orly"
+}
+
+func (p *OrlyProvider) Generate(ctx context.Context, req CoverRequest) ([]byte, error) {
 	query := url.Values{}
-	query.Add("title", title)
-	query.Add("author", author)
+	query.Add("title", req.Title)
+	query.Add("author", req.Author)
 	query.Add("g_loc", "BR")
 	query.Add("top_text", "kaf")
 	query.Add("g_text", "")
-	if img >= 0 && img <= 41 {
-		query.Add("img_id", fmt.Sprintf("%d", img))
+	if req.Idx >= 0 && req.Idx <= 41 {
+		query.Add("img_id", fmt.Sprintf("%d", req.Idx))
 	} else {
 		query.Add("img_id", fmt.Sprintf("%d", rand.Intn(41)))
 	}
-	if strings.HasPrefix(color, "#") {
-		query.Add("color", strings.TrimLeft(color, "#"))
+	if strings.HasPrefix(req.Color, "#") {
+		query.Add("color", strings.TrimLeft(req.Color, "#"))
 	} else {
-		i := ParseInt(color)
-		if i == 0 {
-			i = rand.Intn(17)
+		i := ParseInt(req.Color)
+		if i <= 0 || i >= len(colors) {
+			i = rand.Intn(len(colors))
+		}
+		query.Add("color", strings.TrimLeft(colors[i], "#"))
+	}
+
+	uri := fmt.Sprintf("%s/api/generate?%s", strings.TrimRight(p.BaseURL, "/"), query.Encode())
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: coverTimeout}
+	}
+	res, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return readCoverResponse(res)
+}
+
+// readCoverResponse 校验状态码、内容类型和图片内容，避免把错误页面写成封面
+func readCoverResponse(res *http.Response) ([]byte, error) {
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("封面服务返回错误状态: %s", res.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, "image/") {
+		return nil, fmt.Errorf("封面服务返回的不是图片: %s", res.Header.Get("Content-Type"))
+	}
+	bs, err := io.ReadAll(io.LimitReader(res.Body, maxCoverBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(bs) > maxCoverBytes {
+		return nil, errors.New("封面图片过大")
+	}
+	if _, _, err := image.DecodeConfig(bytes.NewReader(bs)); err != nil {
+		return nil, fmt.Errorf("无法识别封面图片: %w", err)
+	}
+	return bs, nil
+}
+
+// CoverCache 在线封面的本地缓存，同一本书重复转换时不再请求网络
+type CoverCache struct {
+	Dir string
+}
+
+// DefaultCoverCache 使用用户缓存目录，无法获取时返回 nil（不缓存）
+func DefaultCoverCache() *CoverCache {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil
+	}
+	return &CoverCache{Dir: filepath.Join(dir, "kaf-cli", "covers")}
+}
+
+// Key 根据服务名称、书名、作者、主题色和图案生成缓存键
+func (c *CoverCache) Key(provider string, req CoverRequest) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{provider, req.Title, req.Author, req.Color, strconv.Itoa(req.Idx)}, "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Get 查找缓存的封面，不存在时返回空字符串
+func (c *CoverCache) Get(key string) string {
+	matches, _ := filepath.Glob(filepath.Join(c.Dir, key+".*"))
+	for _, match := range matches {
+		if !strings.Contains(filepath.Base(match), "tmp-") {
+			return match
 		}
-		color := colors[i]
-		query.Add("color", strings.TrimLeft(color, "#"))
 	}
+	return ""
+}
 
-	uri := fmt.Sprintf("https://orly.nanmu.me/api/generate?%s", query.Encode())
-	res, err := http.Get(uri)
+// Put 写入缓存并返回文件路径，先写临时文件再重命名，避免并发转换读到不完整的图片
+func (c *CoverCache) Put(key, ext string, bs []byte) (string, error) {
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(c.Dir, "tmp-*")
 	if err != nil {
 		return "", err
 	}
-	tempDir, err := os.MkdirTemp("", "kaf-cli")
-	bs, err := io.ReadAll(res.Body)
+	_, err = f.Write(bs)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
 	if err != nil {
+		os.Remove(f.Name())
 		return "", err
 	}
-	coverfile := filepath.Join(tempDir, fmt.Sprintf("%s.jpg", title))
-	err = os.WriteFile(coverfile, bs, 0666)
+	path := filepath.Join(c.Dir, key+ext)
+	return path, os.Rename(f.Name(), path)
+}
+
+// FetchCover 通过封面服务生成封面，优先使用缓存
+// 没有缓存目录时写入 dir，由调用方负责清理
+func FetchCover(ctx context.Context, provider CoverProvider, cache *CoverCache, req CoverRequest, dir string) (string, error) {
+	var key string
+	if cache != nil {
+		key = cache.Key(provider.Name(), req)
+		if cachefile := cache.Get(key); cachefile != "" {
+			return cachefile, nil
+		}
+	}
+	bs, err := provider.Generate(ctx, req)
 	if err != nil {
 		return "", err
 	}
+	// 按图片实际格式确定扩展名
+	ext := ".jpg"
+	if _, format, err := image.DecodeConfig(bytes.NewReader(bs)); err == nil && format != "jpeg" {
+		ext = "." + format
+	}
+	if cache != nil {
+		cachefile, err := cache.Put(key, ext, bs)
+		if err == nil {
+			return cachefile, nil
+		}
+		fmt.Println("写入封面缓存失败: ", err.Error())
+	}
+	coverfile := filepath.Join(dir, provider.Name()+ext)
+	if err := os.WriteFile(coverfile, bs, 0666); err != nil {
+		return "", err
+	}
 	return coverfile, nil
 }
 
+// GenCover 生成 orly 风格的在线封面
+func GenCover(title, author, color string, img int, dir string) (string, error) {
+	req := CoverRequest{Title: title, Author: author, Color: color, Idx: img}
+	return FetchCover(context.Background(), NewOrlyProvider(), DefaultCoverCache(), req, dir)
+}
+
 func ParseInt(v string) int {
 	v = strings.ReplaceAll(v, ",", "")
 	i, err := strconv.ParseInt(v, 0, 32)
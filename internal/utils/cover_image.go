@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/png"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// 小于该尺寸的封面在阅读器上会明显模糊
+const (
+	minCoverWidth  = 500
+	minCoverHeight = 800
+)
+
+// CoverNormalize 封面预处理参数
+type CoverNormalize struct {
+	Width   int    // 目标宽度
+	Height  int    // 目标高度
+	Fit     string // 比例不一致时的处理方式: letterbox(补边), crop(裁剪), none(不处理)
+	Quality int    // JPG 质量: 1-100
+}
+
+// ParseCoverSize 解析 1600x2560 格式的尺寸
+func ParseCoverSize(size string) (int, int, error) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(size)), "x")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("封面尺寸格式错误: %s, 应为 宽x高, 如 1600x2560", size)
+	}
+	w, err1 := strconv.Atoi(strings.TrimSpace(parts[0]))
+	h, err2 := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err1 != nil || err2 != nil || w <= 0 || h <= 0 {
+		return 0, 0, fmt.Errorf("封面尺寸格式错误: %s, 应为 宽x高, 如 1600x2560", size)
+	}
+	return w, h, nil
+}
+
+// averageColor 图片的平均颜色，用作补边的背景色
+func averageColor(img image.Image) color.Color {
+	dot := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	draw.ApproxBiLinear.Scale(dot, dot.Bounds(), img, img.Bounds(), draw.Src, nil)
+	c := dot.RGBAAt(0, 0)
+	c.A = 0xff
+	return c
+}
+
+// fitCover 按目标尺寸缩放图片，letterbox 时保留完整画面并补边，crop 时居中裁剪
+func fitCover(src image.Image, opt CoverNormalize) image.Image {
+	sb := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, opt.Width, opt.Height))
+	sw, sh := float64(sb.Dx()), float64(sb.Dy())
+	scaleW, scaleH := float64(opt.Width)/sw, float64(opt.Height)/sh
+	if opt.Fit == "crop" {
+		scale := max(scaleW, scaleH)
+		cw, ch := int(float64(opt.Width)/scale), int(float64(opt.Height)/scale)
+		x, y := sb.Min.X+(sb.Dx()-cw)/2, sb.Min.Y+(sb.Dy()-ch)/2
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, image.Rect(x, y, x+cw, y+ch), draw.Src, nil)
+		return dst
+	}
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(averageColor(src)), image.Point{}, draw.Src)
+	scale := min(scaleW, scaleH)
+	w, h := int(sw*scale), int(sh*scale)
+	x, y := (opt.Width-w)/2, (opt.Height-h)/2
+	draw.CatmullRom.Scale(dst, image.Rect(x, y, x+w, y+h), src, sb, draw.Over, nil)
+	return dst
+}
+
+// isBaselineJPEG 按第一个 SOF 标记判断是否为 baseline(SOF0) 编码的 JPG
+// progressive、无损等其他编码在部分 Kindle 上无法显示
+func isBaselineJPEG(data []byte) bool {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return false
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return false
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xff:
+			// 填充字节
+			i++
+			continue
+		case marker == 0xc0:
+			return true
+		case marker >= 0xc1 && marker <= 0xcf && marker != 0xc4 && marker != 0xc8 && marker != 0xcc:
+			return false
+		case marker == 0xd9 || marker == 0xda:
+			return false
+		}
+		i += 2 + int(data[i+2])<<8 + int(data[i+3])
+	}
+	return false
+}
+
+// NormalizeCover 把封面统一缩放为设备尺寸的 baseline JPG 并保存到 dir，返回处理后的文件路径
+// 已经是目标尺寸的 baseline YCbCr JPG 时直接返回原文件，progressive 或 CMYK 的 JPG 重新编码
+func NormalizeCover(filename string, opt CoverNormalize, dir string) (string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("无法识别封面图片: %w", err)
+	}
+	b := src.Bounds()
+	if b.Dx() < minCoverWidth || b.Dy() < minCoverHeight {
+		fmt.Printf("警告: 封面图片尺寸过小(%dx%d), 放大后可能模糊, 建议使用不小于 %dx%d 的图片\n", b.Dx(), b.Dy(), minCoverWidth, minCoverHeight)
+	}
+	if _, ycbcr := src.(*image.YCbCr); format == "jpeg" && ycbcr && isBaselineJPEG(data) &&
+		b.Dx() == opt.Width && b.Dy() == opt.Height {
+		return filename, nil
+	}
+	return saveCover(fitCover(src, opt), opt.Quality, dir)
+}
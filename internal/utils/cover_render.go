@@ -0,0 +1,295 @@
+package utils
+
+import (
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hajimehoshi/bitmapfont/v3"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/text/language"
+)
+
+// Kindle 推荐的封面尺寸
+const (
+	CoverWidth  = 1600
+	CoverHeight = 2560
+)
+
+// coverPatterns 本地封面可用的背景图案数量
+const coverPatterns = 6
+
+// CoverOptions 本地生成封面的参数
+type CoverOptions struct {
+	Title   string
+	Author  string
+	Color   string // 主题色: 1-16 或 hex 颜色代码, 为空时根据书名选择
+	Pattern int    // 背景图案: 0-5, 小于 0 时根据书名选择
+	Lang    string // 书籍语言, 用于选择内置字体的字形
+	Font    string // 字体文件(ttf/otf/ttc), 为空或无法解析时使用内置点阵字体
+}
+
+// seed 根据书名和作者生成固定的随机种子，保证同一本书每次生成的封面相同
+func (opt CoverOptions) seed() uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(opt.Title + "\x00" + opt.Author))
+	return h.Sum32()
+}
+
+// themeColor 解析主题色，兼容 orly 封面的 1-16 编号和 hex 格式
+func (opt CoverOptions) themeColor() color.RGBA {
+	if strings.HasPrefix(opt.Color, "#") {
+		if c, ok := parseHexColor(opt.Color); ok {
+			return c
+		}
+	}
+	i := ParseInt(opt.Color)
+	if i <= 0 || i >= len(colors) {
+		i = int(opt.seed()%uint32(len(colors)-1)) + 1
+	}
+	c, _ := parseHexColor(colors[i])
+	return c
+}
+
+func parseHexColor(s string) (color.RGBA, bool) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) != 6 {
+		return color.RGBA{}, false
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.RGBA{}, false
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, true
+}
+
+// mix 按比例混合两种颜色
+func mix(a, b color.RGBA, t float64) color.RGBA {
+	f := func(x, y uint8) uint8 { return uint8(float64(x)*(1-t) + float64(y)*t) }
+	return color.RGBA{R: f(a.R, b.R), G: f(a.G, b.G), B: f(a.B, b.B), A: 0xff}
+}
+
+// coverFont 封面文字字体：优先使用指定的字体文件，否则使用内置的 12px 点阵字体按整数倍放大
+type coverFont struct {
+	sfnt   *opentype.Font
+	bitmap font.Face
+}
+
+func loadCoverFont(fontfile, lang string) coverFont {
+	cf := coverFont{bitmap: bitmapfont.Face}
+	tag := language.Make(lang)
+	switch base, _ := tag.Base(); base.String() {
+	case "ja":
+		cf.bitmap = bitmapfont.FaceEA
+	case "zh":
+		// zh-TW、zh-HK 等繁体中文使用繁体字形
+		cf.bitmap = bitmapfont.FaceSCEA
+		if script, _ := tag.Script(); script.String() == "Hant" {
+			cf.bitmap = bitmapfont.FaceTCEA
+		}
+	}
+	if fontfile == "" {
+		return cf
+	}
+	bs, err := os.ReadFile(fontfile)
+	if err != nil {
+		fmt.Println("读取封面字体失败, 使用内置字体: ", err.Error())
+		return cf
+	}
+	if f, err := opentype.Parse(bs); err == nil {
+		cf.sfnt = f
+	} else if collection, err := opentype.ParseCollection(bs); err == nil && collection.NumFonts() > 0 {
+		cf.sfnt, _ = collection.Font(0)
+	} else {
+		fmt.Println("解析封面字体失败, 使用内置字体: ", fontfile)
+	}
+	return cf
+}
+
+// face 返回指定像素大小的字体，以及绘制后需要放大的倍数
+func (cf coverFont) face(size int) (font.Face, int) {
+	if cf.sfnt != nil {
+		face, err := opentype.NewFace(cf.sfnt, &opentype.FaceOptions{Size: float64(size), DPI: 72, Hinting: font.HintingFull})
+		if err == nil {
+			return face, 1
+		}
+	}
+	return cf.bitmap, max(size/12, 1)
+}
+
+// wrapText 按宽度折行，英文优先在空格处断开，超过 maxLines 时末尾显示省略号
+func wrapText(face font.Face, text string, width fixed.Int26_6, maxLines int) ([]string, bool) {
+	var lines []string
+	runes := []rune(strings.TrimSpace(text))
+	for len(runes) > 0 {
+		n := len(runes)
+		for n > 1 && font.MeasureString(face, string(runes[:n])) > width {
+			n--
+		}
+		if n < len(runes) {
+			if space := strings.LastIndex(string(runes[:n]), " "); space > 0 {
+				n = len([]rune(string(runes[:n])[:space]))
+			}
+		}
+		lines = append(lines, strings.TrimSpace(string(runes[:n])))
+		runes = []rune(strings.TrimLeft(string(runes[n:]), " "))
+		if len(lines) == maxLines && len(runes) > 0 {
+			last := []rune(lines[maxLines-1])
+			for len(last) > 1 && font.MeasureString(face, string(last)+"…") > width {
+				last = last[:len(last)-1]
+			}
+			lines[maxLines-1] = string(last) + "…"
+			return lines, false
+		}
+	}
+	return lines, true
+}
+
+// drawText 在 dst 上绘制一行文字，y 为文字顶部
+// x 按 align 分别为文字的左侧(left)、中心(center)或右侧(right)位置
+func drawText(dst draw.Image, face font.Face, scale int, text string, x, y int, c color.Color, align string) {
+	metrics := face.Metrics()
+	w := font.MeasureString(face, text).Ceil()
+	h := (metrics.Ascent + metrics.Descent).Ceil()
+	if w == 0 || h == 0 {
+		return
+	}
+	mask := image.NewAlpha(image.Rect(0, 0, w, h))
+	d := font.Drawer{Dst: mask, Src: image.Opaque, Face: face, Dot: fixed.Point26_6{Y: metrics.Ascent}}
+	d.DrawString(text)
+	switch align {
+	case "right":
+		x -= w * scale
+	case "center":
+		x -= w * scale / 2
+	}
+	rect := image.Rect(x, y, x+w*scale, y+h*scale)
+	scaled := image.NewAlpha(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.NearestNeighbor.Scale(scaled, scaled.Bounds(), mask, mask.Bounds(), draw.Src, nil)
+	draw.DrawMask(dst, rect, image.NewUniform(c), image.Point{}, scaled, image.Point{}, draw.Over)
+}
+
+// lineHeight 一行文字绘制后的高度
+func lineHeight(face font.Face, scale int) int {
+	metrics := face.Metrics()
+	return (metrics.Ascent + metrics.Descent).Ceil() * scale
+}
+
+// drawPattern 在指定区域内绘制背景图案
+func drawPattern(img *image.RGBA, rect image.Rectangle, pattern int, fg color.RGBA) {
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			px, py := float64(x-rect.Min.X), float64(y-rect.Min.Y)
+			var on bool
+			switch pattern {
+			case 0: // 斜条纹
+				on = int(px+py)%120 < 40
+			case 1: // 圆点
+				dx, dy := math.Mod(px, 100)-50, math.Mod(py, 100)-50
+				on = dx*dx+dy*dy < 18*18
+			case 2: // 网格
+				on = int(px)%160 < 8 || int(py)%160 < 8
+			case 3: // 同心圆
+				cx, cy := float64(rect.Dx())/2, float64(rect.Dy())/2
+				on = int(math.Hypot(px-cx, py-cy))%90 < 30
+			case 4: // 波浪
+				on = int(py+40*math.Sin(px/80))%100 < 30
+			default: // 菱形格
+				on = (int(math.Abs(math.Mod(px, 160)-80))+int(math.Abs(math.Mod(py, 160)-80)))%80 < 20
+			}
+			if on {
+				img.SetRGBA(x, y, fg)
+			}
+		}
+	}
+}
+
+// RenderCover 在本地绘制封面图片：图案背景、主题色标题栏、书名和作者，无需联网
+func RenderCover(opt CoverOptions) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, CoverWidth, CoverHeight))
+	theme := opt.themeColor()
+	white := color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	paper := color.RGBA{R: 0xf7, G: 0xf4, B: 0xee, A: 0xff}
+	dark := color.RGBA{R: 0x22, G: 0x22, B: 0x22, A: 0xff}
+	draw.Draw(img, img.Bounds(), image.NewUniform(paper), image.Point{}, draw.Src)
+
+	pattern := opt.Pattern
+	if pattern < 0 {
+		pattern = int(opt.seed() >> 8)
+	}
+	// 顶部色条和图案区域
+	draw.Draw(img, image.Rect(0, 0, CoverWidth, 40), image.NewUniform(theme), image.Point{}, draw.Src)
+	art := image.Rect(120, 160, CoverWidth-120, 1200)
+	draw.Draw(img, art, image.NewUniform(mix(theme, white, 0.85)), image.Point{}, draw.Src)
+	drawPattern(img, art, pattern%coverPatterns, mix(theme, white, 0.55))
+
+	cf := loadCoverFont(opt.Font, opt.Lang)
+	margin := 160
+	width := fixed.I(CoverWidth - margin*2)
+
+	// 书名：字号从大到小尝试，直到三行以内能放下
+	var lines []string
+	var face font.Face
+	var scale int
+	for size := 144; size >= 72; size -= 24 {
+		face, scale = cf.face(size)
+		var fit bool
+		lines, fit = wrapText(face, opt.Title, width/fixed.Int26_6(scale), 3)
+		if fit {
+			break
+		}
+	}
+	lh := lineHeight(face, scale)
+	gap := lh / 4
+	band := image.Rect(0, 1300, CoverWidth, 1300+len(lines)*(lh+gap)-gap+160)
+	draw.Draw(img, band, image.NewUniform(theme), image.Point{}, draw.Src)
+	y := band.Min.Y + 80
+	for _, line := range lines {
+		drawText(img, face, scale, line, margin, y, white, "left")
+		y += lh + gap
+	}
+
+	// 作者
+	face, scale = cf.face(96)
+	if authors, _ := wrapText(face, opt.Author, width/fixed.Int26_6(scale), 1); len(authors) > 0 {
+		// 放在标题栏下方，书名较长时紧跟标题栏
+		y := min(band.Max.Y+160, CoverHeight-200-lineHeight(face, scale))
+		drawText(img, face, scale, authors[0], CoverWidth-margin, y, dark, "right")
+	}
+	draw.Draw(img, image.Rect(0, CoverHeight-40, CoverWidth, CoverHeight), image.NewUniform(theme), image.Point{}, draw.Src)
+	return img
+}
+
+// GenLocalCover 生成本地封面并保存为 dir 中的 jpg，返回文件路径
+func GenLocalCover(opt CoverOptions, dir string) (string, error) {
+	return saveCover(RenderCover(opt), 90, dir)
+}
+
+// saveCover 把封面保存为 dir 中的 jpg 文件，文件名不重复，目录由调用方负责清理
+func saveCover(img image.Image, quality int, dir string) (string, error) {
+	f, err := os.CreateTemp(dir, "cover-*.jpg")
+	if err != nil {
+		return "", err
+	}
+	if err := jpeg.Encode(f, img, &jpeg.Options{Quality: quality}); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
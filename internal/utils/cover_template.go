@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	"os"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/fixed"
+)
+
+// CoverTemplate 封面模板：在背景图上绘制书名和作者，坐标基于封面尺寸（默认 1600x2560）
+type CoverTemplate struct {
+	Background      string    `yaml:"background"`       // 背景图片, 为空时使用批量转换文件夹中的通用封面或纯色背景
+	BackgroundColor string    `yaml:"background_color"` // 没有背景图片时的背景色
+	Font            string    `yaml:"font"`             // 字体文件(ttf/otf/ttc), 为空时使用内置点阵字体
+	Title           CoverText `yaml:"title"`            // 书名
+	Author          CoverText `yaml:"author"`           // 作者
+}
+
+// CoverText 封面上一段文字的位置和样式
+type CoverText struct {
+	X        int    `yaml:"x"`         // 文字区域左侧位置
+	Y        int    `yaml:"y"`         // 文字区域顶部位置
+	Width    int    `yaml:"width"`     // 文字区域宽度, 超出时折行, 默认到封面右侧留出相同边距
+	Size     int    `yaml:"size"`      // 字号(像素)
+	Color    string `yaml:"color"`     // 文字颜色(hex)
+	Align    string `yaml:"align"`     // 对齐方式: left, center, right
+	MaxLines int    `yaml:"max_lines"` // 最多行数, 超出时显示省略号
+	Hidden   bool   `yaml:"hidden"`    // 不绘制该文字
+}
+
+// withDefaults 补全未设置的文字样式
+func (text CoverText) withDefaults(width, y, size, maxLines int) CoverText {
+	text.X = DefalutInt(text.X, 160)
+	text.Y = DefalutInt(text.Y, y)
+	text.Width = DefalutInt(text.Width, width-text.X*2)
+	text.Size = DefalutInt(text.Size, size)
+	text.Color = DefaultString(text.Color, "#ffffff")
+	text.Align = DefaultString(text.Align, "left")
+	text.MaxLines = DefalutInt(text.MaxLines, maxLines)
+	return text
+}
+
+// draw 在封面上绘制文字，返回文字底部位置
+func (text CoverText) draw(img draw.Image, cf coverFont, content string) int {
+	if text.Hidden || content == "" {
+		return text.Y
+	}
+	c, ok := parseHexColor(text.Color)
+	if !ok {
+		fmt.Println("封面文字颜色格式错误, 使用白色: ", text.Color)
+		c, _ = parseHexColor("#ffffff")
+	}
+	face, scale := cf.face(text.Size)
+	lines, _ := wrapText(face, content, fixed.I(text.Width)/fixed.Int26_6(scale), text.MaxLines)
+	x := text.X
+	switch text.Align {
+	case "center":
+		x += text.Width / 2
+	case "right":
+		x += text.Width
+	}
+	y := text.Y
+	lh := lineHeight(face, scale)
+	for _, line := range lines {
+		drawText(img, face, scale, line, x, y, c, text.Align)
+		y += lh + lh/4
+	}
+	return y
+}
+
+// RenderTemplateCover 按模板绘制封面
+func RenderTemplateCover(tpl CoverTemplate, title, author, lang string, width, height int) (image.Image, error) {
+	tpl.Title = tpl.Title.withDefaults(width, height*2/5, 144, 3)
+	tpl.Author = tpl.Author.withDefaults(width, height*3/4, 84, 1)
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	if tpl.Background != "" {
+		f, err := os.Open(tpl.Background)
+		if err != nil {
+			return nil, fmt.Errorf("读取封面模板背景失败: %w", err)
+		}
+		defer f.Close()
+		bg, _, err := image.Decode(f)
+		if err != nil {
+			return nil, fmt.Errorf("无法识别封面模板背景: %w", err)
+		}
+		draw.Draw(img, img.Bounds(), fitCover(bg, CoverNormalize{Width: width, Height: height, Fit: "crop"}), image.Point{}, draw.Src)
+	} else {
+		bg, ok := parseHexColor(DefaultString(tpl.BackgroundColor, "#333333"))
+		if !ok {
+			return nil, fmt.Errorf("封面模板背景色格式错误: %s", tpl.BackgroundColor)
+		}
+		draw.Draw(img, img.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	}
+	cf := loadCoverFont(tpl.Font, lang)
+	tpl.Title.draw(img, cf, title)
+	tpl.Author.draw(img, cf, author)
+	return img, nil
+}
+
+// GenTemplateCover 按模板生成封面并保存为 dir 中的 jpg，返回文件路径
+func GenTemplateCover(tpl CoverTemplate, title, author, lang string, width, height, quality int, dir string) (string, error) {
+	img, err := RenderTemplateCover(tpl, title, author, lang, width, height)
+	if err != nil {
+		return "", err
+	}
+	return saveCover(img, quality, dir)
+}
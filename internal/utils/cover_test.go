@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testPNG 生成一张 1x1 的 PNG 图片
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	var buff bytes.Buffer
+	if err := png.Encode(&buff, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	return buff.Bytes()
+}
+
+// newCoverServer 启动模拟的封面服务, 返回服务和请求计数
+func newCoverServer(t *testing.T, handler http.HandlerFunc) (*OrlyProvider, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return &OrlyProvider{BaseURL: server.URL, Client: server.Client()}, &requests
+}
+
+func TestOrlyProviderGenerate(t *testing.T) {
+	pngData := testPNG(t)
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		wantErr string
+	}{
+		{
+			name: "成功",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/generate" || r.URL.Query().Get("title") != "书名" {
+					http.Error(w, "bad request", http.StatusBadRequest)
+					return
+				}
+				w.Header().Set("Content-Type", "image/png")
+				w.Write(pngData)
+			},
+		},
+		{
+			name: "错误状态",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				w.WriteHeader(http.StatusBadGateway)
+				w.Write(pngData)
+			},
+			wantErr: "错误状态",
+		},
+		{
+			name: "返回网页",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.Write([]byte("<html>error</html>"))
+			},
+			wantErr: "不是图片",
+		},
+		{
+			name: "内容不是图片",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				w.Write([]byte("not an image"))
+			},
+			wantErr: "无法识别",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, _ := newCoverServer(t, tt.handler)
+			bs, err := provider.Generate(context.Background(), CoverRequest{Title: "书名", Author: "作者", Idx: -1})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("错误 = %v, 应包含 %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(bs, pngData) {
+				t.Fatalf("返回内容与服务端不一致")
+			}
+		})
+	}
+}
+
+func TestOrlyProviderTimeout(t *testing.T) {
+	provider, _ := newCoverServer(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	provider.Client.Timeout = 50 * time.Millisecond
+	start := time.Now()
+	if _, err := provider.Generate(context.Background(), CoverRequest{Title: "书名", Idx: -1}); err == nil {
+		t.Fatal("超时后应返回错误")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("超时没有生效, 耗时 %s", elapsed)
+	}
+}
+
+func TestFetchCoverCache(t *testing.T) {
+	pngData := testPNG(t)
+	provider, requests := newCoverServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(pngData)
+	})
+	cache := &CoverCache{Dir: t.TempDir()}
+	req := CoverRequest{Title: "书名", Author: "作者", Color: "1", Idx: 3}
+
+	first, err := FetchCover(context.Background(), provider, cache, req, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(first) != cache.Dir || filepath.Ext(first) != ".png" {
+		t.Fatalf("缓存文件路径错误: %s", first)
+	}
+	second, err := FetchCover(context.Background(), provider, cache, req, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first {
+		t.Fatalf("命中缓存时应返回 %s, 实际为 %s", first, second)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("命中缓存时不应请求封面服务, 请求次数 %d", n)
+	}
+
+	// 参数不同时不使用缓存
+	req.Idx = 4
+	if _, err := FetchCover(context.Background(), provider, cache, req, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("参数不同时应重新请求, 请求次数 %d", n)
+	}
+}
+
+func TestFetchCoverWithoutCache(t *testing.T) {
+	pngData := testPNG(t)
+	provider, _ := newCoverServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(pngData)
+	})
+	dir := t.TempDir()
+	coverfile, err := FetchCover(context.Background(), provider, nil, CoverRequest{Title: "书名", Idx: 1}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coverfile != filepath.Join(dir, "orly.png") {
+		t.Fatalf("封面文件路径错误: %s", coverfile)
+	}
+	if _, err := os.Stat(coverfile); err != nil {
+		t.Fatal(err)
+	}
+}
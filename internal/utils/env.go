@@ -2,6 +2,8 @@
 
 import (
 	"os"
+	"strconv"
+	"time"
 )
 
 func GetEnv(key, defaultvalue string) string {
@@ -10,3 +12,14 @@ func GetEnv(key, defaultvalue string) string {
 	}
 	return defaultvalue
 }
+
+// SourceDate 返回写入电子书的时间, 设置了 SOURCE_DATE_EPOCH 环境变量时使用该时间, 以便重复转换得到相同的文件
+// 参考: https://reproducible-builds.org/specs/source-date-epoch/
+func SourceDate() time.Time {
+	if v := os.Getenv("SOURCE_DATE_EPOCH"); v != "" {
+		if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Unix(sec, 0).UTC()
+		}
+	}
+	return time.Now().UTC()
+}
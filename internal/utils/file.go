@@ -1,6 +1,9 @@
 ﻿package utils
 
-import "os"
+import (
+	"os"
+	"strings"
+)
 
 func IsExists(path string) (bool, error) {
 	_, err := os.Stat(path)
@@ -12,3 +15,19 @@ func IsExists(path string) (bool, error) {
 	}
 	return false, err
 }
+
+// SafeFilename 替换文件名中不能使用的字符, 用于按书名、作者生成目录
+func SafeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	// Windows 不允许以点或空格结尾
+	name = strings.TrimRight(name, ". ")
+	if name == "" {
+		return "_"
+	}
+	return name
+}
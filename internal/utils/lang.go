@@ -1,14 +1,41 @@
 ﻿package utils
 
-import "strings"
+import (
+	"slices"
+	"strings"
 
+	"golang.org/x/text/language"
+)
+
+// supportedLangs 支持的书籍语言
+var supportedLangs = []string{"en", "de", "fr", "it", "es", "zh", "ja", "pt", "ru", "nl"}
+
+// ParseLang 检查书籍语言, 保留地区等子标签, 如 zh-TW、zh_CN 规范为 zh-TW、zh-CN
+// 不支持的语言使用 en
 func ParseLang(lang string) string {
-	if lang == "" {
+	if !slices.Contains(supportedLangs, LangBase(lang)) {
 		return "en"
 	}
-	var langs = "en,de,fr,it,es,zh,ja,pt,ru,nl"
-	if strings.Contains(langs, lang) {
-		return lang
+	return language.Make(lang).String()
+}
+
+// LangBase 返回语言的基础语言, 如 zh-TW、zh_CN 返回 zh, 无法识别时返回空字符串
+func LangBase(lang string) string {
+	tag, err := language.Parse(strings.TrimSpace(lang))
+	if err != nil {
+		return ""
+	}
+	base, confidence := tag.Base()
+	if confidence != language.Exact {
+		return ""
+	}
+	return base.String()
+}
+
+// LangValue 按基础语言从 values 中取值, 没有对应语言时使用 fallback 语言的值
+func LangValue[T any](values map[string]T, lang, fallback string) T {
+	if v, ok := values[LangBase(lang)]; ok {
+		return v
 	}
-	return "en"
+	return values[fallback]
 }
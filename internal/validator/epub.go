@@ -0,0 +1,484 @@
+// Package validator 检查生成的 EPUB 是否符合规范, 覆盖书店上传时 epubcheck 最常报告的问题
+package validator
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	mimetype      = "application/epub+zip"
+	containerPath = "META-INF/container.xml"
+)
+
+// Issue 校验发现的问题, Line 为 0 表示与具体行无关
+type Issue struct {
+	File    string
+	Line    int
+	Warning bool // 警告不影响上架, 错误会被 epubcheck 拒绝
+	Message string
+}
+
+func (i Issue) String() string {
+	level := "错误"
+	if i.Warning {
+		level = "警告"
+	}
+	if i.Line > 0 {
+		return fmt.Sprintf("[%s] %s:%d: %s", level, i.File, i.Line, i.Message)
+	}
+	if i.File != "" {
+		return fmt.Sprintf("[%s] %s: %s", level, i.File, i.Message)
+	}
+	return fmt.Sprintf("[%s] %s", level, i.Message)
+}
+
+// HasError 是否有错误级别的问题
+func HasError(issues []Issue) bool {
+	for _, issue := range issues {
+		if !issue.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+type manifestItem struct {
+	ID         string
+	Href       string // 相对于 EPUB 根目录的路径
+	MediaType  string
+	Properties string
+	Line       int
+}
+
+// link 文档中引用的链接或资源
+type link struct {
+	File     string
+	Line     int
+	Target   string // 相对于 EPUB 根目录的路径
+	Fragment string
+	Resource bool // img、link 等引用的资源, 否则为跳转链接
+}
+
+type checker struct {
+	files    map[string]*zip.File
+	issues   []Issue
+	manifest map[string]manifestItem // 按路径索引
+	ids      map[string]map[string]bool
+	links    []link
+}
+
+func (c *checker) add(file string, line int, warning bool, format string, args ...any) {
+	c.issues = append(c.issues, Issue{File: file, Line: line, Warning: warning, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) read(name string) ([]byte, error) {
+	f, ok := c.files[name]
+	if !ok {
+		return nil, fmt.Errorf("文件不存在")
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// Validate 校验 EPUB 文件, 返回发现的问题; 文件无法作为 zip 打开时返回 error
+func Validate(filename string) ([]Issue, error) {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, fmt.Errorf("无法打开 EPUB: %w", err)
+	}
+	defer r.Close()
+	c := &checker{
+		files:    make(map[string]*zip.File),
+		manifest: make(map[string]manifestItem),
+		ids:      make(map[string]map[string]bool),
+	}
+	for _, f := range r.File {
+		c.files[f.Name] = f
+	}
+	c.checkMimetype(r.File)
+	opfPath := c.checkContainer()
+	if opfPath != "" {
+		c.checkPackage(opfPath)
+	}
+	c.checkLinks()
+	return c.issues, nil
+}
+
+// checkMimetype mimetype 必须是第一个文件, 不压缩, 内容为 application/epub+zip
+func (c *checker) checkMimetype(files []*zip.File) {
+	if len(files) == 0 || files[0].Name != "mimetype" {
+		c.add("mimetype", 0, false, "mimetype 必须是压缩包中的第一个文件")
+	}
+	f, ok := c.files["mimetype"]
+	if !ok {
+		return
+	}
+	if f.Method != zip.Store {
+		c.add("mimetype", 0, false, "mimetype 不能压缩")
+	}
+	if len(f.Extra) > 0 {
+		c.add("mimetype", 0, false, "mimetype 不能包含扩展字段")
+	}
+	data, err := c.read("mimetype")
+	if err != nil {
+		c.add("mimetype", 0, false, "读取失败: %s", err)
+		return
+	}
+	if string(data) != mimetype {
+		c.add("mimetype", 0, false, "内容应为 %q, 实际为 %q", mimetype, string(data))
+	}
+}
+
+// checkContainer 检查 container.xml 并返回 OPF 路径
+func (c *checker) checkContainer() string {
+	data, err := c.read(containerPath)
+	if err != nil {
+		c.add(containerPath, 0, false, "缺少 container.xml")
+		return ""
+	}
+	if !c.checkWellFormed(containerPath, data) {
+		return ""
+	}
+	var container struct {
+		Rootfiles []struct {
+			FullPath  string `xml:"full-path,attr"`
+			MediaType string `xml:"media-type,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := xml.Unmarshal(data, &container); err != nil {
+		c.add(containerPath, 0, false, "解析失败: %s", err)
+		return ""
+	}
+	for _, root := range container.Rootfiles {
+		if root.MediaType != "application/oebps-package+xml" {
+			continue
+		}
+		if _, ok := c.files[root.FullPath]; !ok {
+			c.add(containerPath, lineOf(data, root.FullPath), false, "rootfile 指向的 OPF 文件 %s 不存在", root.FullPath)
+			return ""
+		}
+		return root.FullPath
+	}
+	c.add(containerPath, 0, false, "没有 media-type 为 application/oebps-package+xml 的 rootfile")
+	return ""
+}
+
+// checkPackage 检查 OPF 的 manifest 和 spine, 再检查 manifest 中的每个文档
+func (c *checker) checkPackage(opfPath string) {
+	data, err := c.read(opfPath)
+	if err != nil {
+		c.add(opfPath, 0, false, "读取失败: %s", err)
+		return
+	}
+	if !c.checkWellFormed(opfPath, data) {
+		return
+	}
+	base := path.Dir(opfPath)
+	byID := make(map[string]manifestItem)
+	var version, spineToc string
+	var spine []manifestItem
+	var navCount int
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		line, _ := dec.InputPos()
+		attrs := attrMap(se)
+		switch se.Name.Local {
+		case "package":
+			version = attrs["version"]
+		case "item":
+			item := manifestItem{
+				ID:         attrs["id"],
+				MediaType:  attrs["media-type"],
+				Properties: attrs["properties"],
+				Line:       line,
+			}
+			href, _, err := resolve(base, attrs["href"])
+			if err != nil || attrs["href"] == "" {
+				c.add(opfPath, line, false, "manifest 项 %q 的 href 无效", item.ID)
+				continue
+			}
+			item.Href = href
+			if item.ID == "" {
+				c.add(opfPath, line, false, "manifest 项 %s 缺少 id", href)
+			} else if _, ok := byID[item.ID]; ok {
+				c.add(opfPath, line, false, "manifest 中 id %q 重复", item.ID)
+			}
+			if item.MediaType == "" {
+				c.add(opfPath, line, false, "manifest 项 %q 缺少 media-type", item.ID)
+			}
+			if _, ok := c.manifest[href]; ok {
+				c.add(opfPath, line, false, "文件 %s 在 manifest 中重复声明", href)
+			}
+			if _, ok := c.files[href]; !ok {
+				c.add(opfPath, line, false, "manifest 中的文件 %s 不存在", href)
+			}
+			if hasProperty(item.Properties, "nav") {
+				navCount++
+			}
+			byID[item.ID] = item
+			c.manifest[href] = item
+		case "spine":
+			spineToc = attrs["toc"]
+			if spineToc != "" {
+				if item, ok := byID[spineToc]; !ok {
+					c.add(opfPath, line, false, "spine 的 toc %q 不在 manifest 中", spineToc)
+				} else if item.MediaType != "application/x-dtbncx+xml" {
+					c.add(opfPath, line, false, "spine 的 toc %q 不是 NCX 文件", spineToc)
+				}
+			}
+		case "itemref":
+			idref := attrs["idref"]
+			item, ok := byID[idref]
+			if !ok {
+				c.add(opfPath, line, false, "spine 中的 %q 不在 manifest 中", idref)
+				continue
+			}
+			if !isContentDocument(item.MediaType) {
+				c.add(opfPath, line, true, "spine 中的 %q 不是 XHTML 文档", idref)
+			}
+			spine = append(spine, item)
+		case "reference":
+			if href, frag, err := resolve(base, attrs["href"]); err == nil && href != "" {
+				c.links = append(c.links, link{File: opfPath, Line: line, Target: href, Fragment: frag})
+			}
+		}
+	}
+	if len(spine) == 0 {
+		c.add(opfPath, 0, false, "spine 为空")
+	}
+	if strings.HasPrefix(version, "3") && navCount != 1 {
+		c.add(opfPath, 0, false, "EPUB3 必须有且只有一个 properties=\"nav\" 的目录文档, 实际为 %d 个", navCount)
+	}
+	if !strings.HasPrefix(version, "3") && spineToc == "" {
+		c.add(opfPath, 0, false, "EPUB2 的 spine 必须指定 NCX 目录")
+	}
+	// 压缩包中未声明的文件
+	names := make([]string, 0, len(c.files))
+	for name := range c.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.HasSuffix(name, "/") || name == "mimetype" || name == opfPath || strings.HasPrefix(name, "META-INF/") {
+			continue
+		}
+		if _, ok := c.manifest[name]; !ok {
+			c.add(name, 0, true, "文件未在 manifest 中声明")
+		}
+	}
+	// 按路径顺序检查文档
+	hrefs := make([]string, 0, len(c.manifest))
+	for href := range c.manifest {
+		hrefs = append(hrefs, href)
+	}
+	sort.Strings(hrefs)
+	for _, href := range hrefs {
+		item := c.manifest[href]
+		if !isXMLDocument(item.MediaType) {
+			continue
+		}
+		data, err := c.read(href)
+		if err != nil {
+			continue
+		}
+		if c.checkWellFormed(href, data) {
+			c.collect(href, data)
+		}
+	}
+}
+
+// checkWellFormed 按 XML 严格模式检查文档, 只允许 XML 预定义实体
+func (c *checker) checkWellFormed(name string, data []byte) bool {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		_, err := dec.Token()
+		if err == io.EOF {
+			return true
+		}
+		if err != nil {
+			line, _ := dec.InputPos()
+			msg := err.Error()
+			if se, ok := err.(*xml.SyntaxError); ok {
+				line, msg = se.Line, se.Msg
+			}
+			c.add(name, line, false, "XML 格式错误: %s", msg)
+			return false
+		}
+	}
+}
+
+// linkAttrs 引用其他文件的属性, 值为 true 表示引用的是资源
+var linkAttrs = map[string]map[string]bool{
+	"a":      {"href": false},
+	"area":   {"href": false},
+	"link":   {"href": true},
+	"img":    {"src": true},
+	"image":  {"href": true},
+	"script": {"src": true},
+	"source": {"src": true},
+	"audio":  {"src": true},
+	"video":  {"src": true, "poster": true},
+	"iframe": {"src": true},
+	"embed":  {"src": true},
+	"object": {"data": true},
+	// toc.ncx
+	"content": {"src": false},
+}
+
+// collect 收集文档中的 id 和链接
+func (c *checker) collect(name string, data []byte) {
+	ids := make(map[string]bool)
+	c.ids[name] = ids
+	base := path.Dir(name)
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		line, _ := dec.InputPos()
+		attrs := se.Attr
+		for _, attr := range attrs {
+			if attr.Name.Local == "id" {
+				if ids[attr.Value] {
+					c.add(name, line, false, "id %q 重复", attr.Value)
+				}
+				ids[attr.Value] = true
+			}
+		}
+		kinds, ok := linkAttrs[se.Name.Local]
+		if !ok {
+			continue
+		}
+		for _, attr := range attrs {
+			resource, ok := kinds[attr.Name.Local]
+			if !ok || attr.Value == "" || isExternal(attr.Value) {
+				continue
+			}
+			target, frag, err := resolve(base, attr.Value)
+			if err != nil {
+				c.add(name, line, false, "链接 %q 无效", attr.Value)
+				continue
+			}
+			if strings.HasPrefix(attr.Value, "#") {
+				target = name
+			}
+			c.links = append(c.links, link{File: name, Line: line, Target: target, Fragment: frag, Resource: resource})
+		}
+	}
+}
+
+// checkLinks 检查链接目标和资源是否存在
+func (c *checker) checkLinks() {
+	for _, l := range c.links {
+		if _, ok := c.files[l.Target]; !ok {
+			if l.Resource {
+				c.add(l.File, l.Line, false, "引用的资源 %s 不存在", l.Target)
+			} else {
+				c.add(l.File, l.Line, false, "链接目标 %s 不存在", l.Target)
+			}
+			continue
+		}
+		if _, ok := c.manifest[l.Target]; !ok && !strings.HasPrefix(l.Target, "META-INF/") {
+			c.add(l.File, l.Line, false, "引用的文件 %s 未在 manifest 中声明", l.Target)
+			continue
+		}
+		if l.Fragment == "" {
+			continue
+		}
+		if ids, ok := c.ids[l.Target]; ok && !ids[l.Fragment] {
+			c.add(l.File, l.Line, false, "链接目标 %s 中不存在锚点 #%s", l.Target, l.Fragment)
+		}
+	}
+}
+
+// resolve 把文档中的相对链接转换为相对于 EPUB 根目录的路径, 同时返回锚点
+func resolve(base, ref string) (string, string, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Path == "" {
+		return "", u.Fragment, nil
+	}
+	return path.Clean(path.Join(base, u.Path)), u.Fragment, nil
+}
+
+func isExternal(ref string) bool {
+	u, err := url.Parse(ref)
+	return err == nil && u.Scheme != ""
+}
+
+func attrMap(se xml.StartElement) map[string]string {
+	m := make(map[string]string, len(se.Attr))
+	for _, attr := range se.Attr {
+		m[attr.Name.Local] = attr.Value
+	}
+	return m
+}
+
+func hasProperty(properties, name string) bool {
+	for _, p := range strings.Fields(properties) {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isContentDocument(mediaType string) bool {
+	return mediaType == "application/xhtml+xml" || mediaType == "image/svg+xml"
+}
+
+func isXMLDocument(mediaType string) bool {
+	return isContentDocument(mediaType) || mediaType == "application/x-dtbncx+xml"
+}
+
+// lineOf 返回 s 在 data 中第一次出现的行号, 找不到时返回 0
+func lineOf(data []byte, s string) int {
+	i := bytes.Index(data, []byte(s))
+	if i < 0 {
+		return 0
+	}
+	return bytes.Count(data[:i], []byte("\n")) + 1
+}
+
+// Print 输出校验结果
+func Print(filename string, issues []Issue) {
+	if len(issues) == 0 {
+		fmt.Printf("EPUB 校验通过: %s\n", filename)
+		return
+	}
+	var errors int
+	for _, issue := range issues {
+		if !issue.Warning {
+			errors++
+		}
+		fmt.Println(issue)
+	}
+	fmt.Printf("EPUB 校验完成: %s, %d 个错误, %d 个警告\n", filename, errors, len(issues)-errors)
+}
@@ -16,6 +16,7 @@ func Convert(book *Book) error {
 		return err
 	}
 	if err := core.Parse(book); err != nil {
+		book.Cleanup()
 		return err
 	}
 	conv := converter.Dispatcher{Book: book}